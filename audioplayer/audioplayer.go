@@ -2,13 +2,14 @@
 package audioplayer
 
 import (
+	"errors"
 	"log"
 	"path"
 	"sync"
 	"time"
 
-	"github.com/MeesCode/mmjs/database"
 	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
 
 	vlc "github.com/adrg/libvlc-go/v3"
 )
@@ -90,14 +91,58 @@ func GetPlaying() globals.Track {
 // wait for a signal that the track has finished playing.
 // automatically play the next song
 func finishTrack() {
-	// if in database mode, add one to the play counter
-	if globals.Config.Mode == "database" {
-		database.IncrementPlayCounter(GetPlaying().ID)
+	// add one to the play counter, if the library keeps track of them. This
+	// happens in the background so the next track never waits for the database.
+	go countPlay(GetPlaying().ID)
+
+	// keep the music going when the queue runs out, which needs the
+	// database in database mode
+	if Songindex+1 >= len(Playlist) && library.Current.Health().Online {
+		fillQueue()
 	}
 
 	Nextsong()
 }
 
+// countPlay adds one to the play counter of a track
+func countPlay(id int) {
+	err := library.Current.IncrementPlays(id)
+	if err != nil && err != library.ErrUnsupported {
+		log.Println("Could not increment the play counter", err)
+	}
+}
+
+// ErrNotSeekable is returned when seeking in a track that does not support it
+var ErrNotSeekable = errors.New("the track that is playing is not seekable")
+
+// Seek jumps to a time in the track that is playing.
+func Seek(t time.Duration) error {
+	if !player.IsSeekable() {
+		return ErrNotSeekable
+	}
+	return player.SetMediaTime(int(t / time.Millisecond))
+}
+
+// ErrInvalidVolume is returned for a volume outside of 0 to 100
+var ErrInvalidVolume = errors.New("the volume should be between 0 and 100")
+
+// Volume returns the volume in percent, or -1 when there is no audio output yet
+func Volume() int {
+	volume, err := player.Volume()
+	if err != nil {
+		return -1
+	}
+	return volume
+}
+
+// SetVolume sets the volume in percent, from 0 to 100.
+func SetVolume(percent int) error {
+	if percent < 0 || percent > 100 {
+		return ErrInvalidVolume
+	}
+	return player.SetVolume(percent)
+}
+
 // Initialize the speaker with the specification defined at the top.
 func Initialize() {
 	var err error = nil
@@ -0,0 +1,70 @@
+// Package audioplayer controls the audio.
+package audioplayer
+
+import (
+	"log"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+)
+
+// Autofills are the strategies to fill the queue with when it runs out
+var Autofills = []string{"off", "similar", "random"}
+
+// the number of tracks added at a time
+const autofillSize = 5
+
+// fillQueue adds tracks to the end of the queue with the configured strategy.
+// Tracks that are already in the queue are not added again, when there are
+// no similar tracks left random ones are used.
+func fillQueue() {
+	var tracks []globals.Track
+	var err error
+
+	switch globals.Config.Autofill {
+	case "similar":
+		tracks, err = library.Current.Similar(GetPlaying().ID, autofillSize+len(Playlist))
+	case "random":
+		tracks, err = library.Current.Random(autofillSize + len(Playlist))
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Println("Could not fill the queue", err)
+		return
+	}
+
+	added := addNew(tracks)
+	if added == 0 && globals.Config.Autofill == "similar" {
+		tracks, err = library.Current.Random(autofillSize + len(Playlist))
+		if err != nil {
+			log.Println("Could not fill the queue", err)
+			return
+		}
+		addNew(tracks)
+	}
+}
+
+// addNew adds up to autofillSize tracks that are not in the queue yet and
+// returns how many were added
+func addNew(tracks []globals.Track) int {
+	queued := make(map[int]bool, len(Playlist))
+	for _, track := range Playlist {
+		queued[track.ID] = true
+	}
+
+	added := 0
+	for _, track := range tracks {
+		if added == autofillSize {
+			break
+		}
+		if queued[track.ID] {
+			continue
+		}
+		queued[track.ID] = true
+		Playlist = append(Playlist, track)
+		added++
+	}
+	return added
+}
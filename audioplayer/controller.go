@@ -2,6 +2,7 @@
 package audioplayer
 
 import (
+	"errors"
 	"math/rand"
 	"time"
 
@@ -17,6 +18,9 @@ var (
 	SetPause    func(bool) error
 )
 
+// ErrInvalidPosition is returned for positions that are not in the playlist
+var ErrInvalidPosition = errors.New("no such position in the queue")
+
 // PlaySong plays the song at the index of the playlist
 func PlaySong(index int) {
 	if len(Playlist) == 0 || Songindex > len(Playlist) {
@@ -149,3 +153,51 @@ func MoveDown(index int) {
 
 	Playlist[index], Playlist[index+1] = Playlist[index+1], Playlist[index]
 }
+
+// InsertAt inserts a track at a position of the playlist, the tracks from that
+// position on move down. Position len(Playlist) adds it to the end.
+func InsertAt(position int, track globals.Track) error {
+	if position < 0 || position > len(Playlist) {
+		return ErrInvalidPosition
+	}
+
+	// the track that is playing keeps playing
+	if position <= Songindex && len(Playlist) > 0 {
+		Songindex++
+	}
+
+	Playlist = append(Playlist[:position], append([]globals.Track{track}, Playlist[position:]...)...)
+	return nil
+}
+
+// Remove removes the track at a position of the playlist, like Deletesong
+// but the position is checked first.
+func Remove(position int) error {
+	if position < 0 || position >= len(Playlist) {
+		return ErrInvalidPosition
+	}
+	Deletesong(position)
+	return nil
+}
+
+// Move moves the track at position from to position to, the track that is
+// playing keeps playing.
+func Move(from int, to int) error {
+	if from < 0 || from >= len(Playlist) || to < 0 || to >= len(Playlist) {
+		return ErrInvalidPosition
+	}
+
+	switch {
+	case from == Songindex:
+		Songindex = to
+	case from < Songindex && to >= Songindex:
+		Songindex--
+	case from > Songindex && to <= Songindex:
+		Songindex++
+	}
+
+	track := Playlist[from]
+	Playlist = append(Playlist[:from], Playlist[from+1:]...)
+	Playlist = append(Playlist[:to], append([]globals.Track{track}, Playlist[to:]...)...)
+	return nil
+}
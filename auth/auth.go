@@ -0,0 +1,258 @@
+// Package auth decides who may do what on the webserver and web interface.
+// People are recognised by an api token, or by the session they got when
+// logging in with their name and password. Everyone has a role, a guest may
+// search and add tracks, a dj controls the player and the queue and an admin
+// may do everything.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Role is what someone may do, every role may do what the roles before it may
+type Role string
+
+// the roles, from the least to the most allowed
+const (
+	Nobody Role = "nobody"
+	Guest  Role = "guest"
+	DJ     Role = "dj"
+	Admin  Role = "admin"
+)
+
+var roles = []Role{Nobody, Guest, DJ, Admin}
+
+// guests may add this many tracks per window, see AllowAdd
+const guestWindow = time.Hour
+
+var (
+	// ErrUnknownRole is returned for a role that does not exist
+	ErrUnknownRole = errors.New("unknown role, use guest, dj or admin")
+	// ErrLogin is returned when the name or password is wrong
+	ErrLogin = errors.New("wrong name or password")
+)
+
+// LimitError is returned when a guest adds more tracks than allowed
+type LimitError struct {
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("guests may add %d tracks per hour", e.Limit)
+}
+
+// User is who made a request
+type User struct {
+	Name string
+	Role Role
+	key  string // who the limits are counted for
+}
+
+// ID identifies the user for limits, by their account or else their address
+func (u User) ID() string {
+	return u.key
+}
+
+// ParseRole returns the role with the given name, no name means nobody
+func ParseRole(name string) (Role, error) {
+	if name == "" {
+		return Nobody, nil
+	}
+	for _, role := range roles {
+		if string(role) == strings.ToLower(name) {
+			return role, nil
+		}
+	}
+	return Nobody, ErrUnknownRole
+}
+
+// rank returns the position of a role, unknown roles may do nothing
+func (r Role) rank() int {
+	for i, role := range roles {
+		if role == r {
+			return i
+		}
+	}
+	return 0
+}
+
+// Allows reports whether the role may do what needs the given role
+func (r Role) Allows(needed Role) bool {
+	return r.rank() >= needed.rank()
+}
+
+// Check validates the auth settings of the configuration file, when enabled
+func Check() error {
+	config := globals.Config.Auth
+	if !config.Enable {
+		return nil
+	}
+	if _, err := ParseRole(config.Anonymous); err != nil {
+		return fmt.Errorf("anonymous: %w", err)
+	}
+	if config.GuestLimit < 0 {
+		return errors.New("guestLimit should be at least 0")
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, account := range config.Accounts {
+		if account.Name == "" {
+			return errors.New("every account needs a name")
+		}
+		if names[account.Name] {
+			return fmt.Errorf("account %s: the name is used twice", account.Name)
+		}
+		names[account.Name] = true
+
+		if _, err := ParseRole(account.Role); err != nil || account.Role == "" {
+			return fmt.Errorf("account %s: %w", account.Name, ErrUnknownRole)
+		}
+		if account.Password == "" && account.Token == "" {
+			return fmt.Errorf("account %s: needs a password or a token", account.Name)
+		}
+		if account.Password != "" {
+			if _, _, _, err := parseHash(account.Password); err != nil {
+				return fmt.Errorf("account %s: %w", account.Name, err)
+			}
+		}
+		if account.Token != "" {
+			if tokens[account.Token] {
+				return fmt.Errorf("account %s: the token is used twice", account.Name)
+			}
+			tokens[account.Token] = true
+		}
+	}
+	return nil
+}
+
+// accountUser returns the user of an account
+func accountUser(account globals.Account) User {
+	role, _ := ParseRole(account.Role)
+	return User{Name: account.Name, Role: role, key: "account:" + account.Name}
+}
+
+// requestToken returns the api token of a request, from the Authorization
+// header or the token parameter for clients that can not set headers.
+func requestToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Identify returns who made a request. A wrong token makes them nobody, without
+// a token or session they get the anonymous role. Without auth everyone is an
+// admin.
+func Identify(r *http.Request) User {
+	user, _ := identify(r, true)
+	return user
+}
+
+// IdentifyToken is Identify without the session, for the old endpoints of the
+// webserver that change things on a GET. Browsers send the session cookie
+// along with links and redirects from other sites.
+func IdentifyToken(r *http.Request) User {
+	user, _ := identify(r, false)
+	return user
+}
+
+// HasSession reports whether the user of a request comes from their session
+func HasSession(r *http.Request) bool {
+	_, fromSession := identify(r, true)
+	return fromSession
+}
+
+// identify returns who made a request and whether that came from the session,
+// which is only looked at when useSession is true
+func identify(r *http.Request, useSession bool) (User, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !globals.Config.Auth.Enable {
+		return User{Role: Admin, key: "address:" + host}, false
+	}
+
+	if token := requestToken(r); token != "" {
+		for _, account := range globals.Config.Auth.Accounts {
+			if account.Token != "" && subtle.ConstantTimeCompare([]byte(account.Token), []byte(token)) == 1 {
+				return accountUser(account), false
+			}
+		}
+		return User{Role: Nobody, key: "address:" + host}, false
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil && useSession {
+		if user, ok := session(cookie.Value); ok {
+			return user, true
+		}
+	}
+
+	role, _ := ParseRole(globals.Config.Auth.Anonymous)
+	return User{Role: role, key: "address:" + host}, false
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries the user of a request
+func NewContext(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// FromContext returns the user in a context, or nobody
+func FromContext(ctx context.Context) User {
+	if user, ok := ctx.Value(contextKey{}).(User); ok {
+		return user
+	}
+	return User{Role: Nobody}
+}
+
+var (
+	addsMutex sync.Mutex
+	adds      = make(map[string][]time.Time)
+)
+
+// AllowAdd counts n tracks added to the queue by a user and returns a
+// LimitError when a guest would add more than guestLimit in an hour. Djs and
+// admins have no limit.
+func AllowAdd(user User, n int) error {
+	limit := globals.Config.Auth.GuestLimit
+	if user.Role != Guest || limit == 0 {
+		return nil
+	}
+
+	addsMutex.Lock()
+	defer addsMutex.Unlock()
+
+	// forget the adds that are older than the window
+	now := time.Now()
+	recent := adds[user.key][:0]
+	for _, t := range adds[user.key] {
+		if now.Sub(t) < guestWindow {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent)+n > limit {
+		adds[user.key] = recent
+		return &LimitError{limit}
+	}
+	for i := 0; i < n; i++ {
+		recent = append(recent, now)
+	}
+	adds[user.key] = recent
+	return nil
+}
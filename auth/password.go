@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// the scheme of password hashes, pbkdf2 as it can be made with the standard library
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 100000
+	hashSaltLength = 16
+)
+
+// ErrHash is returned for a password hash that was not made with -m password
+var ErrHash = errors.New("the password is not a hash made with -m password")
+
+// pbkdf2 derives a key of sha256.Size bytes from a password, see RFC 8018
+func pbkdf2(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1}) // the first and only block
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// HashPassword returns a salted hash of a password to put in the
+// configuration file, as pbkdf2-sha256$<iterations>$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, hashSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2([]byte(password), salt, hashIterations)
+	return strings.Join([]string{
+		hashScheme,
+		strconv.Itoa(hashIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// parseHash splits a password hash into its iterations, salt and key
+func parseHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, ErrHash
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, ErrHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, ErrHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) != sha256.Size {
+		return 0, nil, nil, ErrHash
+	}
+	return iterations, salt, key, nil
+}
+
+// checkPassword reports whether a password matches a hash
+func checkPassword(hash, password string) bool {
+	iterations, salt, key, err := parseHash(hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, pbkdf2([]byte(password), salt, iterations)) == 1
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// sessions last this long after logging in, they are lost on a restart
+const sessionLength = 7 * 24 * time.Hour
+
+// SessionCookie is the cookie that holds the session of a browser
+const SessionCookie = "mmjs_session"
+
+type loggedIn struct {
+	user    User
+	expires time.Time
+}
+
+var (
+	sessionsMutex sync.Mutex
+	sessions      = make(map[string]loggedIn)
+)
+
+// session returns the user of a session that has not expired
+func session(id string) (User, bool) {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	s, ok := sessions[id]
+	if !ok || time.Now().After(s.expires) {
+		delete(sessions, id)
+		return User{}, false
+	}
+	return s.user, true
+}
+
+// Login checks the name and password of an account and starts a session, the
+// cookie that holds it is returned.
+func Login(name, password string) (*http.Cookie, User, error) {
+	var user User
+	found := false
+	for _, account := range globals.Config.Auth.Accounts {
+		if account.Name == name && account.Password != "" && checkPassword(account.Password, password) {
+			user = accountUser(account)
+			found = true
+		}
+	}
+	if !found {
+		return nil, User{}, ErrLogin
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, User{}, err
+	}
+	id := hex.EncodeToString(b)
+	expires := time.Now().Add(sessionLength)
+
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	// forget the sessions that expired
+	for other, s := range sessions {
+		if time.Now().After(s.expires) {
+			delete(sessions, other)
+		}
+	}
+	sessions[id] = loggedIn{user, expires}
+
+	return &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}, user, nil
+}
+
+// Logout ends the session of a request, the returned cookie removes it from
+// the browser.
+func Logout(r *http.Request) *http.Cookie {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		sessionsMutex.Lock()
+		delete(sessions, cookie.Value)
+		sessionsMutex.Unlock()
+	}
+	return &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1}
+}
@@ -0,0 +1,80 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// ErrBanNotFound is returned when a ban that is removed does not exist
+var ErrBanNotFound = errors.New("ban not found")
+
+// GetBans returns the entire ban list, ordered by kind and value
+func GetBans(ctx context.Context) ([]globals.Ban, error) {
+	rows, err := db.QueryContext(ctx, stmts.findBans)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make([]globals.Ban, 0)
+	for rows.Next() {
+		var ban globals.Ban
+		if err = rows.Scan(&ban.ID, &ban.Kind, &ban.Value, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+
+	return bans, rows.Err()
+}
+
+// AddBan puts a track, artist, genre or folder on the ban list and returns
+// the ID of the ban. Banning something twice returns the existing ban.
+func AddBan(ctx context.Context, kind string, value string) (int, error) {
+	_, err := db.ExecContext(ctx, stmts.insertBan, kind, value, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = db.QueryRowContext(ctx, stmts.findBan, kind, value).Scan(&id)
+	return id, err
+}
+
+// RemoveBan removes a ban from the ban list
+func RemoveBan(ctx context.Context, id int) error {
+	res, err := db.ExecContext(ctx, stmts.deleteBan, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrBanNotFound
+	}
+	return err
+}
+
+// GetBannedTrackIDs returns the IDs of every track that is banned, whether
+// by itself or by its artist, genre or folder.
+func GetBannedTrackIDs(ctx context.Context) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, stmts.bannedTracks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	banned := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		banned[id] = true
+	}
+
+	return banned, rows.Err()
+}
@@ -0,0 +1,112 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// ErrUnknownTag is returned when browsing by a tag that can not be browsed by
+var ErrUnknownTag = errors.New("can not browse by this tag")
+
+// the column (or expression) for every tag that can be browsed by
+var groupColumns = map[string]string{
+	"artist": "Artist",
+	"album":  "Album",
+	"genre":  "Genre",
+	"year":   "Year",
+	"decade": "(Year - Year % 10)",
+}
+
+// selectionSQL turns a selection into a where clause with its arguments
+func selectionSQL(selection []globals.Group) (string, []interface{}) {
+	clauses := []string{"1 = 1"}
+	args := make([]interface{}, 0, len(selection))
+
+	for _, group := range selection {
+		column, ok := groupColumns[group.Tag]
+		if !ok {
+			continue
+		}
+
+		if group.Value == "" {
+			clauses = append(clauses, column+" IS NULL")
+			continue
+		}
+
+		clauses = append(clauses, column+" = ?")
+
+		// numbers have to be compared as numbers, not all drivers convert them
+		if n, err := strconv.Atoi(group.Value); err == nil && (group.Tag == "year" || group.Tag == "decade") {
+			args = append(args, n)
+		} else {
+			args = append(args, group.Value)
+		}
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
+
+// GetGroups returns a page of the distinct values of a tag among the tracks in
+// the selection, with the number of tracks that have each value and their
+// plays, and the number of values on all pages.
+func GetGroups(ctx context.Context, tag string, selection []globals.Group, page globals.Page) ([]globals.Group, int, error) {
+	column, ok := groupColumns[tag]
+	if !ok {
+		return nil, 0, ErrUnknownTag
+	}
+
+	where, args := selectionSQL(selection)
+	query := "SELECT " + column + ", COUNT(*), COALESCE(SUM(Plays), 0) FROM Tracks WHERE " + where +
+		" GROUP BY " + column + " ORDER BY " + column
+
+	limit, limitArgs := pageSQL(page)
+	groups, err := queryGroups(ctx, tag, query+limit, append(args, limitArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page.Offset == 0 && (page.Limit == 0 || len(groups) < page.Limit) {
+		return groups, len(groups), nil
+	}
+
+	total, err := countRows(ctx, query, args...)
+	return groups, total, err
+}
+
+// queryGroups reads the value, number of tracks and plays of every group
+func queryGroups(ctx context.Context, tag string, query string, args ...interface{}) ([]globals.Group, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]globals.Group, 0)
+	for rows.Next() {
+		var value sql.NullString
+		group := globals.Group{Tag: tag}
+
+		err = rows.Scan(&value, &group.Count, &group.Plays)
+		if err != nil {
+			return nil, err
+		}
+
+		group.Value = value.String
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// GetTracksInSelection returns a page of the tracks that have every tag value
+// in the selection, and the number of tracks on all pages.
+func GetTracksInSelection(ctx context.Context, selection []globals.Group, page globals.Page) ([]globals.Track, int, error) {
+	where, args := selectionSQL(selection)
+	return QueryTracks(ctx, where, page, args...)
+}
@@ -2,9 +2,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"log"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/MeesCode/mmjs/globals"
 )
@@ -13,318 +15,300 @@ import (
 // root folder always has id 1 and parentid 0 //
 ////////////////////////////////////////////////
 
-// GetFoldersByParentID returns the folders with the provided ParentID.
-func GetFoldersByParentID(parentid int) []globals.Folder {
-	folders := make([]globals.Folder, 0)
+// maxParams is the most parameters put in a single query, older versions of
+// sqlite do not accept more than 999
+const maxParams = 500
+
+// scanner is either a single row or a set of rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTrack reads a track from a row that selects the columns of the track
+// statements: TrackID, Path, FolderID, Title, Album, Artist, Genre, Year,
+// Inferred, Rating, Favourite and Plays.
+func scanTrack(row scanner) (globals.Track, error) {
+	var track globals.Track
+	err := row.Scan(
+		&track.ID,
+		&track.Path,
+		&track.FolderID,
+		&track.Title,
+		&track.Album,
+		&track.Artist,
+		&track.Genre,
+		&track.Year,
+		&track.Inferred,
+		&track.Rating,
+		&track.Favourite,
+		&track.Plays)
+	return track, err
+}
 
-	rows, err := db.Query(stmts.findSubFolders, parentid)
+// queryTracks performs a query that selects tracks and returns all of them.
+func queryTracks(ctx context.Context, query string, args ...interface{}) ([]globals.Track, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("could not find folder", err)
-		return nil
+		return nil, err
 	}
 	defer rows.Close()
 
+	tracks := make([]globals.Track, 0)
 	for rows.Next() {
-		var folder globals.Folder
-		err = rows.Scan(&folder.ID, &folder.Path, &folder.ParentID)
-
+		track, err := scanTrack(rows)
 		if err != nil {
-			log.Println("Could not find folder", err)
-		} else {
-			folders = append(folders, folder)
+			return nil, err
 		}
-
+		tracks = append(tracks, track)
 	}
 
-	return folders
-
+	return tracks, rows.Err()
 }
 
-// GetFolderByID returns the folder with the provided ID.
-func GetFolderByID(folderid int) globals.Folder {
-	var folder globals.Folder
-
-	err := db.QueryRow(stmts.findFolder, folderid).Scan(&folder.ID, &folder.Path, &folder.ParentID)
-	if err != nil {
-		log.Fatalln("could not prepare statement. Did you forget to run index mode first?", err)
+// pageSQL returns the limit clause of a page with its arguments, the query
+// has to have an order to get the same pages every time.
+func pageSQL(page globals.Page) (string, []interface{}) {
+	if page.Limit > 0 {
+		return " LIMIT ? OFFSET ?", []interface{}{page.Limit, page.Offset}
 	}
-
-	return folder
-
+	if page.Offset > 0 {
+		return " LIMIT " + stmts.noLimit + " OFFSET ?", []interface{}{page.Offset}
+	}
+	return "", nil
 }
 
-// GetTracksByFolderID returns all tracks that are in a given folder.
-func GetTracksByFolderID(folderid int) []globals.Track {
-	tracks := make([]globals.Track, 0)
+// countRows returns the number of rows a query results in, on all pages
+func countRows(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+query+") counted", args...).Scan(&total)
+	return total, err
+}
 
-	rows, err := db.Query(stmts.findTracksInFolder, folderid)
+// queryTrackPage returns a page of the tracks a query selects, together with
+// the number of tracks on all pages.
+func queryTrackPage(ctx context.Context, query string, page globals.Page, args ...interface{}) ([]globals.Track, int, error) {
+	limit, limitArgs := pageSQL(page)
+	tracks, err := queryTracks(ctx, query+limit, append(args, limitArgs...)...)
 	if err != nil {
-		log.Println("Could not find folder", err)
-		return nil
+		return nil, 0, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var track globals.Track
-		err = rows.Scan(
-			&track.ID,
-			&track.Path,
-			&track.FolderID,
-			&track.Title,
-			&track.Album,
-			&track.Artist,
-			&track.Genre,
-			&track.Year)
-
-		if err != nil {
-			log.Println("Could not find metadata, file corrupt?", err)
-		} else {
-			tracks = append(tracks, track)
-		}
 
+	// the first page has everything when it is not full, which saves a count
+	if page.Offset == 0 && (page.Limit == 0 || len(tracks) < page.Limit) {
+		return tracks, len(tracks), nil
 	}
 
-	return tracks
-
+	total, err := countRows(ctx, query, args...)
+	return tracks, total, err
 }
 
-// GetSearchResults searches the database for a specific term and
-// return the results. The results are found by checking if the given search term matches
-// the beginning of either the Title, Artist or Album name. Results are ordered by album.
-// Tries to remove duplicates.
-func GetSearchResults(term string) []globals.Track {
-
-	tracks := make([]globals.Track, 0)
-
-	rows, err := db.Query(stmts.searchTracks, term+"%", term+"%", "%"+term+"%", term+"%")
+// GetFoldersByParentID returns a page of the folders with the provided
+// ParentID, and the number of folders on all pages.
+func GetFoldersByParentID(ctx context.Context, parentid int, page globals.Page) ([]globals.Folder, int, error) {
+	limit, limitArgs := pageSQL(page)
+	rows, err := db.QueryContext(ctx, stmts.findSubFolders+limit, append([]interface{}{parentid}, limitArgs...)...)
 	if err != nil {
-		log.Println("Could not perform search query", err)
-		return nil
+		return nil, 0, err
 	}
 	defer rows.Close()
 
+	folders := make([]globals.Folder, 0)
 	for rows.Next() {
-		var track globals.Track
-		err = rows.Scan(
-			&track.ID,
-			&track.Path,
-			&track.FolderID,
-			&track.Title,
-			&track.Album,
-			&track.Artist,
-			&track.Genre,
-			&track.Year)
-
+		var folder globals.Folder
+		err = rows.Scan(&folder.ID, &folder.Path, &folder.ParentID)
 		if err != nil {
-			log.Println("Could not find metadata, file corrupt?", err)
-		} else {
-
-			//check for duplicates
-			dup := false
-			for _, t := range tracks {
-				if track.Artist == t.Artist && track.Title == t.Title {
-					dup = true
-					break
-				}
-			}
-
-			if !dup {
-				tracks = append(tracks, track)
-			}
-
+			return nil, 0, err
 		}
-
+		folders = append(folders, folder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
 	}
 
-	return tracks
+	if page.Offset == 0 && (page.Limit == 0 || len(folders) < page.Limit) {
+		return folders, len(folders), nil
+	}
 
+	total, err := countRows(ctx, stmts.findSubFolders, parentid)
+	return folders, total, err
 }
 
-// GetRandomTracks get n random tracks from the database
-func GetRandomTracks(n int) []globals.Track {
+// GetFolderByID returns the folder with the provided ID. When there is no
+// such folder the error is sql.ErrNoRows, which usually means the library
+// has not been indexed yet.
+func GetFolderByID(ctx context.Context, folderid int) (globals.Folder, error) {
+	var folder globals.Folder
+	err := db.QueryRowContext(ctx, stmts.findFolder, folderid).Scan(&folder.ID, &folder.Path, &folder.ParentID)
+	return folder, err
+}
 
-	if n < 1 {
-		return nil
+// GetFolderByPath returns the folder with the provided path, relative to the
+// root. When there is no such folder the error is sql.ErrNoRows.
+func GetFolderByPath(ctx context.Context, rpath string) (globals.Folder, error) {
+	var id int
+	if err := db.QueryRowContext(ctx, stmts.findFolderByPath, rpath).Scan(&id); err != nil {
+		return globals.Folder{}, err
 	}
+	return GetFolderByID(ctx, id)
+}
 
-	tracks := make([]globals.Track, 0)
-
-	rows, err := db.Query(stmts.randomTracks, n)
-	if err != nil {
-		log.Println("Could not perform search query", err)
-		return nil
-	}
-	defer rows.Close()
+// GetTrackByID returns the track with the provided ID.
+func GetTrackByID(ctx context.Context, trackid int) (globals.Track, error) {
+	return scanTrack(db.QueryRowContext(ctx, stmts.findTrack, trackid))
+}
 
-	for rows.Next() {
-		var track globals.Track
-		err = rows.Scan(
-			&track.ID,
-			&track.Path,
-			&track.FolderID,
-			&track.Title,
-			&track.Album,
-			&track.Artist,
-			&track.Genre,
-			&track.Year)
+// GetTracksByIDs returns the tracks with the provided IDs, ordered like
+// QueryTracks. IDs that are not in the database (any more) are left out.
+func GetTracksByIDs(ctx context.Context, ids []int) ([]globals.Track, error) {
+	tracks := make([]globals.Track, 0, len(ids))
+	for len(ids) > 0 {
+		// stay below the number of parameters a query may have
+		chunk := ids
+		if len(chunk) > maxParams {
+			chunk = chunk[:maxParams]
+		}
+		ids = ids[len(chunk):]
 
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		found, _, err := QueryTracks(ctx, "TrackID IN (?"+strings.Repeat(", ?", len(chunk)-1)+")", globals.Page{}, args...)
 		if err != nil {
-			log.Println("Could not find metadata, file corrupt?", err)
-		} else {
-			tracks = append(tracks, track)
+			return nil, err
 		}
-
+		tracks = append(tracks, found...)
 	}
-
-	return tracks
-
+	return tracks, nil
 }
 
-// GetPopularTracks get n popular tracks from the database
-func GetPopularTracks(n int) []globals.Track {
-
-	if n < 1 {
-		return nil
-	}
-
-	tracks := make([]globals.Track, 0)
-
-	rows, err := db.Query(stmts.popularTracks, n)
-	if err != nil {
-		log.Println("Could not perform search query", err)
-		return nil
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var track globals.Track
-		err = rows.Scan(
-			&track.ID,
-			&track.Path,
-			&track.FolderID,
-			&track.Title,
-			&track.Album,
-			&track.Artist,
-			&track.Genre,
-			&track.Year,
-			&track.Plays)
-
-		if err != nil {
-			log.Println("Could not find metadata, file corrupt?", err)
-		} else {
-			tracks = append(tracks, track)
-		}
+// GetTracksByFolderID returns a page of the tracks that are in a given
+// folder, and the number of tracks on all pages.
+func GetTracksByFolderID(ctx context.Context, folderid int, page globals.Page) ([]globals.Track, int, error) {
+	return queryTrackPage(ctx, stmts.findTracksInFolder, page, folderid)
+}
 
-	}
+// GetAllTracks returns every track in the database, this is used to build the search index.
+func GetAllTracks(ctx context.Context) ([]globals.Track, error) {
+	return queryTracks(ctx, stmts.allTracks)
+}
 
-	return tracks
+// QueryTracks returns a page of the tracks that satisfy the given where
+// clause, ordered by artist and album, and the number of tracks on all pages.
+// The clause is built by the search package, never by users.
+func QueryTracks(ctx context.Context, where string, page globals.Page, args ...interface{}) ([]globals.Track, int, error) {
+	return queryTrackPage(ctx, stmts.queryTracks+where+" ORDER BY Artist, Album, Path", page, args...)
+}
 
+// QueryAllowedTracks is QueryTracks without the tracks that are banned
+func QueryAllowedTracks(ctx context.Context, where string, page globals.Page, args ...interface{}) ([]globals.Track, int, error) {
+	return QueryTracks(ctx, "("+where+") AND "+stmts.notBanned, page, args...)
 }
 
-// SavePlaylist saves aplaylist to the database
-func SavePlaylist(name string, tracks []globals.Track) {
-	res, err := db.Exec(stmts.insertPlaylist, name)
-	id, err2 := res.LastInsertId()
-	if err != nil || err2 != nil {
-		log.Fatalln("could not create playlist", err, err2)
+// GetRandomTracks get n random tracks from the database
+func GetRandomTracks(ctx context.Context, n int) ([]globals.Track, error) {
+	if n < 1 {
+		return nil, nil
 	}
+	return queryTracks(ctx, stmts.randomTracks, n)
+}
 
-	for _, track := range tracks {
-		db.Exec(stmts.insertPlaylistTrack, track.ID, id)
+// GetPopularTracks get n popular tracks from the database
+func GetPopularTracks(ctx context.Context, n int) ([]globals.Track, error) {
+	if n < 1 {
+		return nil, nil
 	}
-
+	return queryTracks(ctx, stmts.popularTracks, n)
 }
 
-// GetPlaylistTracks return all tracks in a playlist
-func GetPlaylistTracks(playlistid int) []globals.Track {
-	tracks := make([]globals.Track, 0)
-
-	rows, err := db.Query(stmts.findTracksInPlaylist, playlistid)
-	if err != nil {
-		log.Println("Could not perform query", err)
+// IncrementPlayCounter increments the play counter of a given track by one
+// and records the play in the history. While the database is offline the
+// play is queued and written once it is back.
+func IncrementPlayCounter(ctx context.Context, trackid int) error {
+	play := Play{TrackID: trackid, PlayedAt: time.Now().Unix()}
+	if !Online() {
+		queuePlay(play)
 		return nil
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var track globals.Track
-		err = rows.Scan(
-			&track.ID,
-			&track.Path,
-			&track.FolderID,
-			&track.Title,
-			&track.Album,
-			&track.Artist,
-			&track.Genre,
-			&track.Year)
+	err := recordPlay(ctx, play)
+	if err != nil && !check() {
+		queuePlay(play)
+		return nil
+	}
+	return err
+}
 
+// recordPlay writes a play to the counter and the history
+func recordPlay(ctx context.Context, play Play) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, stmts.incrementCounter, play.TrackID)
 		if err != nil {
-			log.Println("Could not find track in database", err)
-		} else {
-			tracks = append(tracks, track)
+			return err
 		}
 
-	}
-
-	return tracks
+		_, err = tx.ExecContext(ctx, stmts.insertPlay, play.TrackID, play.PlayedAt)
+		return err
+	})
+}
 
+// SetRating sets the star rating of a track, 0 removes the rating. When there
+// is no such track the error is sql.ErrNoRows.
+func SetRating(ctx context.Context, trackid int, rating int) error {
+	return updateTrack(ctx, stmts.setRating, rating, trackid)
 }
 
-// GetPlaylists searches the database for all playlists and return them desguised as tracks
-func GetPlaylists() []globals.Track {
-	playlists := make([]globals.Track, 0)
+// SetFavourite marks a track as favourite or removes the mark. When there is
+// no such track the error is sql.ErrNoRows.
+func SetFavourite(ctx context.Context, trackid int, favourite bool) error {
+	return updateTrack(ctx, stmts.setFavourite, favourite, trackid)
+}
 
-	rows, err := db.Query(stmts.findPlaylists)
+// updateTrack runs an update of the track with the id that is the last
+// argument. Mysql only counts the rows that changed, so when nothing changed
+// the track is looked up to tell whether it exists.
+func updateTrack(ctx context.Context, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
-		log.Println("Could not perform search query", err)
-		return nil
+		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var playlist globals.Track
-		err = rows.Scan(
-			&playlist.ID,
-			&playlist.Title)
-
-		playlist.Album = sql.NullString{String: "playlist", Valid: true}
-		playlist.Artist = sql.NullString{String: "playlist", Valid: true}
-		playlist.FolderID = -1
-		playlist.Genre = sql.NullString{String: "playlist", Valid: true}
-		playlist.Path = "not applicable"
-		playlist.Year = sql.NullInt64{Int64: 0, Valid: false}
-
-		if err != nil {
-			log.Println("Could not find playlist", err)
-		} else {
-			playlists = append(playlists, playlist)
-		}
-
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
 	}
+	var id int
+	return db.QueryRowContext(ctx, "SELECT TrackID FROM Tracks WHERE TrackID = ?", args[len(args)-1]).Scan(&id)
+}
 
-	return playlists
-
+// UpdatePath changes the path of the file
+func UpdatePath(ctx context.Context, path string, trackid int) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, stmts.updatePath, path, trackid); err != nil {
+			return err
+		}
+		return bumpVersion(ctx, tx)
+	})
 }
 
-// IncrementPlayCounter increments the play counter of a given track by one
-func IncrementPlayCounter(track_id int) {
-	_, err := db.Exec(stmts.incrementCounter, track_id)
-	if err != nil {
-		log.Println("Could not increment the play counter", err)
-	}
+// LibraryVersion returns a counter that goes up whenever tracks are indexed or
+// their tags are edited, by this or another process
+func LibraryVersion(ctx context.Context) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, stmts.libraryVersion).Scan(&version)
+	return version, err
 }
 
-// updatePath changes the path of the file
-func UpdatePath(path string, track_id int) {
-	_, err := db.Exec(stmts.updatePath, path, track_id)
-	if err != nil {
-		log.Println("Could not update path", err)
-	}
+// bumpVersion increases the library version
+func bumpVersion(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, stmts.bumpVersion)
+	return err
 }
 
 // GetRandomPath gets a random path from the database
-func GetRandomPath() string {
+func GetRandomPath(ctx context.Context) (string, error) {
 	var relpath string
-	db.QueryRow(stmts.randomPath).Scan(&relpath)
-	return path.Join(globals.Root, relpath)
-}
\ No newline at end of file
+	err := db.QueryRowContext(ctx, stmts.randomPath).Scan(&relpath)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(globals.Root, relpath), nil
+}
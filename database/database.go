@@ -3,15 +3,21 @@ package database
 
 import (
 	"database/sql"
-	"log"
+	"context"
+	"fmt"
 	"strconv"
 	"time"
-	"context"
-	"errors"
 
 	"github.com/MeesCode/mmjs/globals"
+
+	// the storage drivers register themselves with database/sql
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// Timeout is how long a single database call may take before it is cancelled
+const Timeout = 10 * time.Second
+
 // this stuct holds all defined statements
 var (
 	stmts definedStatements
@@ -25,77 +31,172 @@ type definedStatements struct {
 	findSubFolders       string
 	findFolder           string
 	findFolderByPath     string
+	findTrack            string
 	findTracksInFolder   string
-	searchTracks         string
+	allTracks            string
+	queryTracks          string
 	insertPlaylistTrack  string
 	insertPlaylist       string
+	insertSmartPlaylist  string
+	updateRules          string
 	findTracksInPlaylist string
 	findPlaylists        string
+	findPlaylist         string
+	findPlaylistByName   string
+	findPlaylistEntries  string
+	deletePlaylistTracks string
+	renamePlaylist       string
+	deletePlaylist       string
 	incrementCounter     string
+	insertPlay           string
+	setRating            string
+	setFavourite         string
+	insertTagEdit        string
+	findTagEdits         string
+	findTrackTagEdits    string
 	randomTracks         string
+	bannedTracks         string
+	findBans             string
+	findBan              string
+	insertBan            string
+	deleteBan            string
 	popularTracks        string
 	updatePath           string
 	deleteTrack          string
 	randomPath           string
+	libraryVersion       string
+	bumpVersion          string
+	notBanned            string
+	noLimit              string
 }
 
-// Warmup the mysql connection pool
-func Warmup() (*sql.DB, error) {
-	stmts.insertFolder = "INSERT IGNORE INTO Folders(Path, ParentID) VALUES(?, ?)"
-	stmts.insertTrack = `INSERT IGNORE INTO Tracks(Path, FolderID, Title, Album, Artist, Genre, Year) VALUES(?, ?, ?, ?, ?, ?, ?)`
+// Context returns a context that cancels a database call after the Timeout.
+func Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), Timeout)
+}
+
+// Warmup the connection pool of the configured storage driver (mysql or sqlite)
+// and applies pending migrations when allowed to. Connecting times out on its
+// own, the context is mostly there to cancel long migrations.
+func Warmup(ctx context.Context) (*sql.DB, error) {
+
+	// the few places where the sql dialects differ, an offset needs a
+	// limit so pages without one use the largest limit there is
+	insertIgnore, random := "INSERT IGNORE", "RAND()"
+	inFolder := "LEFT(Tracks.Path, CHAR_LENGTH(Bans.Value) + 1) = CONCAT(Bans.Value, '/')"
+	stmts.noLimit = "18446744073709551615"
+	if globals.Config.Database.Driver == "sqlite" {
+		insertIgnore, random = "INSERT OR IGNORE", "RANDOM()"
+		inFolder = "SUBSTR(Tracks.Path, 1, LENGTH(Bans.Value) + 1) = Bans.Value || '/'"
+		stmts.noLimit = "-1"
+	}
+
+	// whether a track is on the ban list, by its id, artist, genre or folder
+	banned := `EXISTS (SELECT 1 FROM Bans WHERE 
+		(Bans.Kind = 'track' AND Bans.Value = CAST(Tracks.TrackID AS CHAR)) OR 
+		(Bans.Kind = 'artist' AND LOWER(Bans.Value) = LOWER(Tracks.Artist)) OR 
+		(Bans.Kind = 'genre' AND LOWER(Bans.Value) = LOWER(Tracks.Genre)) OR 
+		(Bans.Kind = 'folder' AND ` + inFolder + `))`
+
+	stmts.insertFolder = insertIgnore + " INTO Folders(Path, ParentID) VALUES(?, ?)"
+	stmts.insertTrack = insertIgnore + ` INTO Tracks(Path, FolderID, Title, Album, Artist, Genre, Year, Inferred) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
 	stmts.findSubFolders = `SELECT FolderId, Path, ParentId FROM 
 		Folders WHERE ParentID = ? ORDER BY Path`
 	stmts.findFolder = `SELECT FolderId, Path, ParentId FROM 
 		Folders WHERE FolderID = ?`
 	stmts.findFolderByPath = "SELECT FolderID FROM Folders WHERE Path = ?"
+	stmts.findTrack = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
+		Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks WHERE TrackID = ?`
 	stmts.findTracksInFolder = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
-		Genre, Year FROM Tracks WHERE FolderID = ?`
-	stmts.searchTracks = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
-		Genre, Year FROM Tracks WHERE Artist LIKE ? OR Title LIKE ? OR Path LIKE ? OR Album LIKE ? ORDER BY Album`
+		Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks WHERE FolderID = ? ORDER BY Path`
+	stmts.allTracks = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
+		Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks`
+	stmts.queryTracks = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
+		Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks WHERE `
 	stmts.insertPlaylist = `INSERT INTO Playlists (Name) VALUES (?)`
-	stmts.insertPlaylistTrack = `INSERT INTO PlaylistEntries (TrackID, PlaylistID) VALUES (?, ?)`
+	stmts.insertPlaylistTrack = `INSERT INTO PlaylistEntries (TrackID, PlaylistID, Position) VALUES (?, ?, ?)`
 	stmts.findTracksInPlaylist = `SELECT Tracks.TrackID, Tracks.Path, Tracks.FolderID, 
-		Tracks.Title, Tracks.Album, Tracks.Artist, Tracks.Genre, Tracks.Year 
+		Tracks.Title, Tracks.Album, Tracks.Artist, Tracks.Genre, Tracks.Year, Tracks.Inferred, Tracks.Rating, Tracks.Favourite, Tracks.Plays 
 		FROM Tracks 
 		JOIN PlaylistEntries ON Tracks.TrackID = PlaylistEntries.TrackID 
-		JOIN Playlists ON Playlists.PlaylistID = PlaylistEntries.PlaylistID 
-		WHERE Playlists.PlaylistID = ?`
-	stmts.findPlaylists = `SELECT PlaylistID, Name FROM Playlists`
+		WHERE PlaylistEntries.PlaylistID = ? 
+		ORDER BY PlaylistEntries.Position`
+	stmts.insertSmartPlaylist = `INSERT INTO Playlists (Name, Rules) VALUES (?, ?)`
+	stmts.findPlaylists = `SELECT Playlists.PlaylistID, Playlists.Name, Playlists.Rules, COUNT(PlaylistEntries.PlaylistEntryID) 
+		FROM Playlists 
+		LEFT JOIN PlaylistEntries ON Playlists.PlaylistID = PlaylistEntries.PlaylistID 
+		GROUP BY Playlists.PlaylistID, Playlists.Name, Playlists.Rules 
+		ORDER BY Playlists.Name`
+	stmts.findPlaylist = `SELECT PlaylistID, Name, Rules FROM Playlists WHERE PlaylistID = ?`
+	stmts.updateRules = `UPDATE Playlists SET Rules = ? WHERE PlaylistID = ?`
+	stmts.findPlaylistByName = `SELECT PlaylistID FROM Playlists WHERE Name = ?`
+	stmts.findPlaylistEntries = `SELECT TrackID FROM PlaylistEntries WHERE PlaylistID = ? ORDER BY Position`
+	stmts.deletePlaylistTracks = `DELETE FROM PlaylistEntries WHERE PlaylistID = ?`
+	stmts.renamePlaylist = `UPDATE Playlists SET Name = ? WHERE PlaylistID = ?`
+	stmts.deletePlaylist = `DELETE FROM Playlists WHERE PlaylistID = ?`
 	stmts.incrementCounter = `UPDATE Tracks SET Plays = Plays + 1 WHERE TrackID = ?`
+	stmts.insertPlay = `INSERT INTO PlayHistory (TrackID, PlayedAt) VALUES (?, ?)`
+	stmts.setRating = `UPDATE Tracks SET Rating = ? WHERE TrackID = ?`
+	stmts.setFavourite = `UPDATE Tracks SET Favourite = ? WHERE TrackID = ?`
+	stmts.insertTagEdit = `INSERT INTO TagEdits (TrackID, Field, OldValue, NewValue, EditedAt, WrittenBack) 
+		VALUES (?, ?, ?, ?, ?, ?)`
+	stmts.findTagEdits = `SELECT EditID, TrackID, Field, OldValue, NewValue, EditedAt, WrittenBack 
+		FROM TagEdits ORDER BY EditID DESC LIMIT ?`
+	stmts.findTrackTagEdits = `SELECT EditID, TrackID, Field, OldValue, NewValue, EditedAt, WrittenBack 
+		FROM TagEdits WHERE TrackID = ? ORDER BY EditID DESC LIMIT ?`
 	stmts.randomTracks = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
-	Genre, Year FROM Tracks ORDER BY RAND() LIMIT ?`
+	Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks WHERE Rating <> 1 AND NOT ` + banned + ` ORDER BY ` + random + ` LIMIT ?`
 	stmts.popularTracks = `SELECT TrackID, Path, FolderID, Title, Album, Artist, 
-	Genre, Year, Plays FROM Tracks ORDER BY Plays DESC LIMIT ?`
+	Genre, Year, Inferred, Rating, Favourite, Plays FROM Tracks WHERE NOT ` + banned + ` ORDER BY Plays DESC LIMIT ?`
+	stmts.bannedTracks = `SELECT TrackID FROM Tracks WHERE ` + banned
+	stmts.notBanned = `NOT ` + banned
+	stmts.findBans = `SELECT BanID, Kind, Value, CreatedAt FROM Bans ORDER BY Kind, Value`
+	stmts.findBan = `SELECT BanID FROM Bans WHERE Kind = ? AND Value = ?`
+	stmts.insertBan = insertIgnore + ` INTO Bans (Kind, Value, CreatedAt) VALUES (?, ?, ?)`
+	stmts.deleteBan = `DELETE FROM Bans WHERE BanID = ?`
 	stmts.updatePath = `UPDATE Tracks SET Path = ? where TrackID = ?`
 	stmts.deleteTrack = `DELETE FROM Tracks where TrackID = ?`
-	stmts.randomPath = `SELECT Path From Tracks ORDER BY RAND() LIMIT 1`
-
-	dbc, err := sql.Open("mysql",
-		globals.Config.Database.User+":"+
-		globals.Config.Database.Password+"@("+
-		globals.Config.Database.Host+":"+
-		strconv.Itoa(globals.Config.Database.Port)+")/"+
-		globals.Config.Database.Database)
+	stmts.randomPath = `SELECT Path From Tracks ORDER BY ` + random + ` LIMIT 1`
+	stmts.libraryVersion = `SELECT Version FROM LibraryVersion`
+	stmts.bumpVersion = `UPDATE LibraryVersion SET Version = Version + 1`
 
-	dbc.SetConnMaxLifetime(time.Minute * 5)
+	var dbc *sql.DB
+	var err error
+	if globals.Config.Database.Driver == "sqlite" {
+		dbc, err = openSqlite(globals.Config.Database.File)
+	} else {
+		dbc, err = sql.Open("mysql",
+			globals.Config.Database.User+":"+
+			globals.Config.Database.Password+"@("+
+			globals.Config.Database.Host+":"+
+			strconv.Itoa(globals.Config.Database.Port)+")/"+
+			globals.Config.Database.Database)
+	}
 
 	if err != nil {
-		log.Fatalln("connection with database could not be established", err)
+		return nil, fmt.Errorf("connection with database could not be established: %w", err)
 	}
-	
-	// check for database connection
 
-	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	dbc.SetConnMaxLifetime(time.Minute * 5)
+
+	// check for database connection, migrations may take longer than that
+	ping, cancel := context.WithTimeout(ctx, Timeout)
 	defer cancel()
 
-	err = dbc.PingContext(ctx)
+	err = dbc.PingContext(ping)
 	if err != nil {
-		return nil, errors.New("Cannot connect to database")
-		log.Fatalln("database error")
+		dbc.Close()
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
 	}
 
 	db = dbc
 
+	// make sure the schema is up to date
+	err = checkSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return dbc, nil
 }
 
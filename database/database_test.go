@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// openTestDatabase creates an empty sqlite database with the latest schema
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	globals.Config.Database.Driver = "sqlite"
+	globals.Config.Database.File = filepath.Join(t.TempDir(), "mmjs.db")
+	globals.Config.Database.Migrate = true
+
+	dbc, err := Warmup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbc.Close() })
+}
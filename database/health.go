@@ -0,0 +1,143 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// how often the connection is checked while the database is online, and the
+// longest wait between reconnect attempts while it is offline
+const (
+	checkInterval = 15 * time.Second
+	pingTimeout   = 3 * time.Second
+	maxBackoff    = time.Minute
+)
+
+// health holds the state of the connection and the plays that could not be
+// written while the database was offline
+var health = struct {
+	sync.Mutex
+	online  bool
+	since   time.Time
+	pending []Play
+}{online: true, since: time.Now()}
+
+// GetHealth returns whether the database is online, since when, and how many
+// plays are waiting to be written.
+func GetHealth() globals.Health {
+	health.Lock()
+	defer health.Unlock()
+	return globals.Health{
+		Online:       health.online,
+		Since:        health.since.Unix(),
+		PendingPlays: len(health.pending),
+	}
+}
+
+// Online reports whether the last check could reach the database
+func Online() bool {
+	health.Lock()
+	defer health.Unlock()
+	return health.online
+}
+
+// setOnline records a change of the connection state
+func setOnline(online bool) {
+	health.Lock()
+	defer health.Unlock()
+	if health.online == online {
+		return
+	}
+	health.online = online
+	health.since = time.Now()
+	if online {
+		log.Println("database is back online")
+	} else {
+		log.Println("database is offline")
+	}
+}
+
+// check pings the database and records whether it could be reached
+func check() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	setOnline(err == nil)
+	return err == nil
+}
+
+// Monitor checks the connection in the background for as long as the program
+// runs. While the database is offline it tries to reconnect with a backoff
+// that doubles up to a minute, once it is back the queued plays are written.
+func Monitor() {
+	wait := checkInterval
+	offline := false
+	for {
+		<-time.After(wait)
+
+		if !check() {
+			wait = retryWait(offline, wait)
+			offline = true
+			continue
+		}
+
+		offline = false
+		wait = checkInterval
+		flushPlays()
+	}
+}
+
+// retryWait returns how long to wait after a failed check. Right after going
+// offline that is a second, after that the wait doubles up to maxBackoff.
+func retryWait(offline bool, wait time.Duration) time.Duration {
+	if !offline {
+		return time.Second
+	}
+	if wait *= 2; wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// queuePlay keeps a play to write once the database is back
+func queuePlay(play Play) {
+	health.Lock()
+	defer health.Unlock()
+	health.pending = append(health.pending, play)
+}
+
+// flushPlays writes the queued plays in the order they were played. When the
+// database goes away again the rest stays queued, plays that fail for any
+// other reason (such as a track that was removed) are dropped.
+func flushPlays() {
+	health.Lock()
+	pending := health.pending
+	health.pending = nil
+	health.Unlock()
+
+	for i, play := range pending {
+		ctx, cancel := Context()
+		err := recordPlay(ctx, play)
+		cancel()
+
+		if err != nil && !check() {
+			health.Lock()
+			health.pending = append(pending[i:], health.pending...)
+			health.Unlock()
+			return
+		}
+		if err != nil {
+			log.Println("Could not write queued play of track", play.TrackID, err)
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Println("wrote", len(pending), "queued plays")
+	}
+}
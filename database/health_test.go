@@ -0,0 +1,28 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryWaitBacksOffToMax(t *testing.T) {
+	wait := retryWait(false, checkInterval)
+	if wait != time.Second {
+		t.Fatalf("first retry after %s, want 1s", wait)
+	}
+
+	// a dead database should end up being tried once a minute
+	var waits []time.Duration
+	for i := 0; i < 10; i++ {
+		wait = retryWait(true, wait)
+		waits = append(waits, wait)
+	}
+	for i := 1; i < len(waits); i++ {
+		if waits[i] < waits[i-1] {
+			t.Fatalf("wait went down from %s to %s: %v", waits[i-1], waits[i], waits)
+		}
+	}
+	if wait != maxBackoff {
+		t.Fatalf("wait is %s after 10 failures, want %s", wait, maxBackoff)
+	}
+}
@@ -2,6 +2,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,39 +11,40 @@ import (
 	"strings"
 
 	"github.com/MeesCode/mmjs/globals"
-
-	"github.com/dhowden/tag"
-
-	// this is needed but i don't know why it is blank
-	// probably just does some stuff in the background
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/MeesCode/mmjs/metadata"
 )
 
 // Index indexes every folder and playable file that is contained within the
-// specified root folder. It ignores hidden folders entirely.
-func Index() {
+// specified root folder. It ignores hidden folders entirely. Files that can
+// not be added are logged and skipped, indexing stops when the context is done.
+func Index(ctx context.Context) error {
 
-	var err error
-	findFolderByPath, err := db.Prepare(stmts.findFolderByPath)
+	findFolderByPath, err := db.PrepareContext(ctx, stmts.findFolderByPath)
 	if err != nil {
-		log.Fatalln("could not prepare statements")
+		return fmt.Errorf("could not prepare statements: %w", err)
 	}
+	defer findFolderByPath.Close()
 
-	insertFolder, err := db.Prepare(stmts.insertFolder)
+	insertFolder, err := db.PrepareContext(ctx, stmts.insertFolder)
 	if err != nil {
-		log.Fatalln("could not prepare statements")
+		return fmt.Errorf("could not prepare statements: %w", err)
 	}
+	defer insertFolder.Close()
 
-	insertTrack, err := db.Prepare(stmts.insertTrack)
+	insertTrack, err := db.PrepareContext(ctx, stmts.insertTrack)
 	if err != nil {
-		log.Fatalln("could not prepare statements")
+		return fmt.Errorf("could not prepare statements: %w", err)
 	}
+	defer insertTrack.Close()
 
 	err = filepath.Walk(globals.Root,
 		func(file string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
 
 			// make sure it's a playable file
 			if info.IsDir() ||
@@ -63,7 +65,7 @@ func Index() {
 				var parentID = 0
 
 				if !isRoot {
-					err = findFolderByPath.QueryRow(path.Dir(rpath)).Scan(&parentID)
+					err = findFolderByPath.QueryRowContext(ctx, path.Dir(rpath)).Scan(&parentID)
 					if err != nil {
 						log.Println("Could not perform query, or query returned empty. query: ", path.Dir(rpath), err)
 					}
@@ -73,12 +75,12 @@ func Index() {
 				if info.IsDir() {
 					if isRoot {
 						// special case for when it's the root folder
-						_, err = insertFolder.Exec("/", parentID)
+						_, err = insertFolder.ExecContext(ctx, "/", parentID)
 						if err != nil {
 							log.Println("Could not add root to the database", err)
 						}
 					} else {
-						_, err = insertFolder.Exec(rpath, parentID)
+						_, err = insertFolder.ExecContext(ctx, rpath, parentID)
 						if err != nil {
 							log.Println("Could not add folder to the database", err)
 						}
@@ -90,22 +92,20 @@ func Index() {
 					// if we've encountered a playable file, add it to the file list
 					if globals.Contains(globals.GetSupportedFormats(), strings.ToLower(path.Ext(file))) {
 
-						// read metadata
-						f, _ := os.Open(file)
-						m, err := tag.ReadFrom(f)
-
-						// if no tags were found default to nil
+						// read metadata, missing tags are inferred from the path
+						track := metadata.ReadTrack(file)
+
+						_, err = insertTrack.ExecContext(ctx,
+							rpath,
+							parentID,
+							track.Title,
+							track.Album,
+							track.Artist,
+							track.Genre,
+							track.Year,
+							track.Inferred)
 						if err != nil {
-							_, err = insertTrack.Exec(rpath, parentID, nil, nil, nil, nil, nil)
-						} else {
-							_, err = insertTrack.Exec(
-								rpath,
-								parentID,
-								StringToSQLNullableString(m.Title()),
-								StringToSQLNullableString(m.Album()),
-								StringToSQLNullableString(m.Artist()),
-								StringToSQLNullableString(m.Genre()),
-								IntToSQLNullableInt(m.Year()))
+							log.Println("Could not add track to the database", err)
 						}
 					}
 
@@ -115,8 +115,10 @@ func Index() {
 			return nil
 		})
 	if err != nil {
-		log.Fatalln("Could not walk the filesystem at the given location", err)
+		return fmt.Errorf("could not walk the filesystem at the given location: %w", err)
 	}
 
-	return
+	// running jukeboxes rebuild their search index
+	_, err = db.ExecContext(ctx, stmts.bumpVersion)
+	return err
 }
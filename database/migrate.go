@@ -0,0 +1,239 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/go-sql-driver/mysql"
+)
+
+// migrations holds the schema changes for every storage driver. Files are named
+// <version>_<description>.sql and are applied in order of their version.
+// A migration must never be changed once it has been released, add a new one instead.
+//
+// Every migration runs in a transaction with its version bump. Mysql commits
+// each CREATE and ALTER at once though, so a mysql migration that failed
+// halfway is run again from the start: statements that created a table,
+// column or index that already exists are skipped, and other statements
+// should be safe to run twice.
+//
+//go:embed migrations
+var migrations embed.FS
+
+// migrationFiles is where the migrations are read from
+var migrationFiles fs.FS = migrations
+
+// migration is a single versioned schema change
+type migration struct {
+	version int
+	name    string
+	file    string
+}
+
+// the table that records which migrations have been applied
+const createSchemaVersion = `CREATE TABLE IF NOT EXISTS schema_version (
+	Version int NOT NULL PRIMARY KEY,
+	Name varchar(191) NOT NULL,
+	AppliedAt timestamp DEFAULT CURRENT_TIMESTAMP)`
+
+// driverMigrations lists the migrations of the configured storage driver in order
+func driverMigrations() ([]migration, error) {
+	dir := "migrations/mysql"
+	if globals.Config.Database.Driver == "sqlite" {
+		dir = "migrations/sqlite"
+	}
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, errors.New("migration without version: " + entry.Name())
+		}
+		list = append(list, migration{version: version, name: name, file: path.Join(dir, entry.Name())})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// SchemaVersion returns the version the database is currently at.
+func SchemaVersion(ctx context.Context) (int, error) {
+	_, err := db.ExecContext(ctx, createSchemaVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(Version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 {
+		return baseline(ctx)
+	}
+
+	return version, nil
+}
+
+// baseline records the version of databases that were created before migrations
+// existed (with database.sql or the first sqlite driver), so that their data is kept.
+func baseline(ctx context.Context) (int, error) {
+
+	// an empty database starts from scratch
+	if _, err := db.ExecContext(ctx, "SELECT 1 FROM Tracks LIMIT 1"); err != nil {
+		return 0, nil
+	}
+
+	version := 1
+	if _, err := db.ExecContext(ctx, "SELECT Inferred FROM Tracks LIMIT 1"); err == nil {
+		version = 2
+	}
+
+	list, err := driverMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range list {
+		if m.version > version {
+			break
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO schema_version (Version, Name) VALUES (?, ?)", m.version, m.name)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	log.Println("existing database recorded at schema version", version)
+	return version, nil
+}
+
+// PendingMigrations returns the names of the migrations that have not been applied yet.
+func PendingMigrations(ctx context.Context) ([]string, error) {
+	version, err := SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := driverMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]string, 0)
+	for _, m := range list {
+		if m.version > version {
+			pending = append(pending, m.name)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order. Each migration is recorded
+// in schema_version in the same transaction that applies it.
+func Migrate(ctx context.Context) error {
+	version, err := SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	list, err := driverMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		if m.version <= version {
+			continue
+		}
+
+		content, err := fs.ReadFile(migrationFiles, m.file)
+		if err != nil {
+			return err
+		}
+
+		err = inTransaction(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range splitStatements(string(content)) {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil && !alreadyApplied(err) {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_version (Version, Name) VALUES (?, ?)", m.version, m.name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+
+		log.Println("applied migration", m.name)
+	}
+
+	return nil
+}
+
+// alreadyApplied reports whether a statement failed because mysql already
+// has the table (1050), column (1060) or index (1061) it creates
+func alreadyApplied(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == 1050 || mysqlErr.Number == 1060 || mysqlErr.Number == 1061
+}
+
+// splitStatements splits a migration into separate statements, since not
+// every driver accepts multiple statements at once. Comment lines are dropped.
+func splitStatements(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	stmts := make([]string, 0)
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if strings.TrimSpace(stmt) != "" {
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+	}
+	return stmts
+}
+
+// checkSchema verifies that the database is up to date, applying the pending
+// migrations when allowed to.
+func checkSchema(ctx context.Context) error {
+	pending, err := PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if globals.Config.Database.Migrate {
+		return Migrate(ctx)
+	}
+
+	return errors.New("Database schema is out of date, " + strconv.Itoa(len(pending)) +
+		" migration(s) pending. Run mmjs -m migrate to apply them")
+}
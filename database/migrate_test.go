@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestFailedMigrationLeavesNothingBehind(t *testing.T) {
+	openTestDatabase(t)
+	ctx := context.Background()
+
+	before, err := SchemaVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := "migrations/sqlite/0099_broken.sql"
+	files := fstest.MapFS{file: {Data: []byte(
+		"CREATE TABLE Broken (ID int);\nALTER TABLE Tracks ADD COLUMN Broken int;\nSELECT Nonsense FROM Nowhere;\n")}}
+	migrationFiles = files
+	defer func() { migrationFiles = migrations }()
+
+	if err := Migrate(ctx); err == nil {
+		t.Fatal("broken migration was applied")
+	}
+	if version, _ := SchemaVersion(ctx); version != before {
+		t.Errorf("schema version is %d after a failed migration, want %d", version, before)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'Broken'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("failed migration left table Broken behind (%d, %v)", tables, err)
+	}
+
+	// once fixed the same migration applies cleanly, the column was not added twice
+	files[file] = &fstest.MapFile{Data: []byte(
+		"CREATE TABLE Broken (ID int);\nALTER TABLE Tracks ADD COLUMN Broken int;\n")}
+	if err := Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := SchemaVersion(ctx); version != 99 {
+		t.Errorf("schema version is %d, want 99", version)
+	}
+}
+
+func TestAlreadyApplied(t *testing.T) {
+	for number, want := range map[uint16]bool{1050: true, 1060: true, 1061: true, 1146: false} {
+		if got := alreadyApplied(&mysql.MySQLError{Number: number}); got != want {
+			t.Errorf("alreadyApplied(%d) = %v, want %v", number, got, want)
+		}
+	}
+	if alreadyApplied(context.Canceled) {
+		t.Error("alreadyApplied is true for a non-mysql error")
+	}
+}
@@ -0,0 +1,6 @@
+-- keep playlist entries in an explicit order, existing entries keep
+-- the order in which they were added
+
+ALTER TABLE PlaylistEntries ADD COLUMN Position int NOT NULL DEFAULT 0;
+UPDATE PlaylistEntries SET Position = PlaylistEntryID;
+CREATE INDEX PlaylistEntriesPosition ON PlaylistEntries(PlaylistID, Position);
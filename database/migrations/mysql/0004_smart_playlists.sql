@@ -0,0 +1,4 @@
+-- smart playlists are stored as a search query instead of entries,
+-- for example: genre:metal year:<1990 sort:-plays limit:50
+
+ALTER TABLE Playlists ADD COLUMN Rules varchar(255) DEFAULT NULL;
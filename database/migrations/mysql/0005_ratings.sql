@@ -0,0 +1,4 @@
+-- star ratings from 1 to 5 (0 is unrated) and a favourite flag per track
+
+ALTER TABLE Tracks ADD COLUMN Rating tinyint NOT NULL DEFAULT 0;
+ALTER TABLE Tracks ADD COLUMN Favourite tinyint NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- every finished play with the time it ended, in seconds since 1970, for the
+-- listening statistics. there is no foreign key so the history survives
+-- tracks that are removed from the library.
+
+CREATE TABLE IF NOT EXISTS PlayHistory (
+  PlayID int NOT NULL AUTO_INCREMENT,
+  TrackID int NOT NULL,
+  PlayedAt bigint NOT NULL,
+  PRIMARY KEY (PlayID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 ROW_FORMAT=DYNAMIC;
+
+CREATE INDEX PlayHistoryTrackID ON PlayHistory(TrackID);
@@ -0,0 +1,16 @@
+-- an audit log of every tag that was edited by hand, with the value before and
+-- after the edit and whether it was also written to the file. like the play
+-- history there is no foreign key so the log survives removed tracks.
+
+CREATE TABLE IF NOT EXISTS TagEdits (
+  EditID int NOT NULL AUTO_INCREMENT,
+  TrackID int NOT NULL,
+  Field varchar(16) NOT NULL,
+  OldValue varchar(191) DEFAULT NULL,
+  NewValue varchar(191) DEFAULT NULL,
+  EditedAt bigint NOT NULL,
+  WrittenBack tinyint NOT NULL DEFAULT 0,
+  PRIMARY KEY (EditID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 ROW_FORMAT=DYNAMIC;
+
+CREATE INDEX TagEditsTrackID ON TagEdits(TrackID);
@@ -0,0 +1,13 @@
+-- the ban list of the jukebox. Kind is track, artist, genre or folder and Value
+-- the track id, the artist or genre name or the path of the folder. banned
+-- tracks are kept out of search results, random and popular tracks and can
+-- not be queued from the web.
+
+CREATE TABLE IF NOT EXISTS Bans (
+  BanID int NOT NULL AUTO_INCREMENT,
+  Kind varchar(16) NOT NULL,
+  Value varchar(512) NOT NULL,
+  CreatedAt bigint NOT NULL,
+  PRIMARY KEY (BanID),
+  UNIQUE KEY BansKindValue (Kind, Value)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 ROW_FORMAT=DYNAMIC;
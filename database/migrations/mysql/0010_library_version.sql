@@ -0,0 +1,8 @@
+-- a counter that goes up whenever tracks or their tags change, also by an
+-- index run in another process, so the search index knows when to rebuild
+
+CREATE TABLE IF NOT EXISTS LibraryVersion (
+  Version int NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO LibraryVersion (Version) SELECT 1 FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM LibraryVersion);
@@ -0,0 +1,33 @@
+-- the same schema as the mysql one, in sqlite dialect
+
+CREATE TABLE IF NOT EXISTS Folders (
+  FolderID INTEGER PRIMARY KEY AUTOINCREMENT,
+  Path varchar(512) NOT NULL UNIQUE,
+  ParentID int DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Tracks (
+  TrackID INTEGER PRIMARY KEY AUTOINCREMENT,
+  Path varchar(512) NOT NULL UNIQUE,
+  FolderID int NOT NULL REFERENCES Folders(FolderID),
+  Title varchar(191) DEFAULT NULL,
+  Album varchar(191) DEFAULT NULL,
+  Artist varchar(191) DEFAULT NULL,
+  Genre varchar(191) DEFAULT NULL,
+  Year int DEFAULT NULL,
+  Plays int DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS Playlists (
+  PlaylistID INTEGER PRIMARY KEY AUTOINCREMENT,
+  Name varchar(191) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS PlaylistEntries (
+  PlaylistEntryID INTEGER PRIMARY KEY AUTOINCREMENT,
+  TrackID int NOT NULL REFERENCES Tracks(TrackID),
+  PlaylistID int NOT NULL REFERENCES Playlists(PlaylistID)
+);
+
+CREATE INDEX IF NOT EXISTS TracksFolderID ON Tracks(FolderID);
+CREATE INDEX IF NOT EXISTS FoldersParentID ON Folders(ParentID);
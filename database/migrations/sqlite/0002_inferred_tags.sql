@@ -0,0 +1,3 @@
+-- remember which tags were inferred from the path
+
+ALTER TABLE Tracks ADD COLUMN Inferred varchar(64) DEFAULT NULL;
@@ -0,0 +1,11 @@
+-- every finished play with the time it ended, in seconds since 1970, for the
+-- listening statistics. there is no foreign key so the history survives
+-- tracks that are removed from the library.
+
+CREATE TABLE IF NOT EXISTS PlayHistory (
+  PlayID INTEGER PRIMARY KEY AUTOINCREMENT,
+  TrackID int NOT NULL,
+  PlayedAt bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS PlayHistoryTrackID ON PlayHistory(TrackID);
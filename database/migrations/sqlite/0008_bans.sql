@@ -0,0 +1,12 @@
+-- the ban list of the jukebox. Kind is track, artist, genre or folder and Value
+-- the track id, the artist or genre name or the path of the folder. banned
+-- tracks are kept out of search results, random and popular tracks and can
+-- not be queued from the web.
+
+CREATE TABLE IF NOT EXISTS Bans (
+  BanID INTEGER PRIMARY KEY AUTOINCREMENT,
+  Kind varchar(16) NOT NULL,
+  Value varchar(512) NOT NULL,
+  CreatedAt bigint NOT NULL,
+  UNIQUE (Kind, Value)
+);
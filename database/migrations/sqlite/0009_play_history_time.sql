@@ -0,0 +1,3 @@
+-- similar tracks look up the plays around the plays of a track by time
+
+CREATE INDEX IF NOT EXISTS PlayHistoryPlayedAt ON PlayHistory(PlayedAt);
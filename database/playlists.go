@@ -0,0 +1,313 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// errors returned by the playlist functions
+var (
+	ErrPlaylistExists   = errors.New("a playlist with this name already exists")
+	ErrPlaylistNotFound = errors.New("playlist not found")
+	ErrInvalidPosition  = errors.New("position is outside of the playlist")
+	ErrSmartPlaylist    = errors.New("the tracks of a smart playlist follow from its rules")
+	ErrNotSmart         = errors.New("only smart playlists have rules")
+)
+
+// GetPlaylists returns all playlists with the number of tracks in them, ordered by name.
+func GetPlaylists(ctx context.Context) ([]globals.Playlist, error) {
+	rows, err := db.QueryContext(ctx, stmts.findPlaylists)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := make([]globals.Playlist, 0)
+	for rows.Next() {
+		var playlist globals.Playlist
+		var rules sql.NullString
+		err = rows.Scan(
+			&playlist.ID,
+			&playlist.Name,
+			&rules,
+			&playlist.Tracks)
+
+		if err != nil {
+			return nil, err
+		}
+		playlist.Rules = rules.String
+		playlists = append(playlists, playlist)
+	}
+
+	return playlists, rows.Err()
+}
+
+// GetPlaylist returns the playlist with the given ID, without its tracks.
+func GetPlaylist(ctx context.Context, playlistid int) (globals.Playlist, error) {
+	return findPlaylist(db.QueryRowContext(ctx, stmts.findPlaylist, playlistid))
+}
+
+// findPlaylist scans the row of the findPlaylist statement
+func findPlaylist(row *sql.Row) (globals.Playlist, error) {
+	var playlist globals.Playlist
+	var rules sql.NullString
+	err := row.Scan(&playlist.ID, &playlist.Name, &rules)
+	if err == sql.ErrNoRows {
+		return playlist, ErrPlaylistNotFound
+	}
+	playlist.Rules = rules.String
+	return playlist, err
+}
+
+// GetPlaylistTracks return a page of the tracks in a playlist, in order, and
+// the number of tracks on all pages.
+func GetPlaylistTracks(ctx context.Context, playlistid int, page globals.Page) ([]globals.Track, int, error) {
+	return queryTrackPage(ctx, stmts.findTracksInPlaylist, page, playlistid)
+}
+
+// SavePlaylist saves the tracks as a new playlist and returns its ID.
+// Returns ErrPlaylistExists if the name is already taken.
+func SavePlaylist(ctx context.Context, name string, tracks []globals.Track) (int, error) {
+	var id int64
+
+	err := inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := checkPlaylistName(ctx, tx, name, -1); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, stmts.insertPlaylist, name)
+		if err != nil {
+			return err
+		}
+
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		return writePlaylist(ctx, tx, int(id), trackIDs(tracks))
+	})
+
+	return int(id), err
+}
+
+// SaveSmartPlaylist saves a playlist whose tracks are selected by a search
+// query, and returns its ID. Returns ErrPlaylistExists if the name is already taken.
+func SaveSmartPlaylist(ctx context.Context, name string, rules string) (int, error) {
+	var id int64
+
+	err := inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := checkPlaylistName(ctx, tx, name, -1); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, stmts.insertSmartPlaylist, name, rules)
+		if err != nil {
+			return err
+		}
+
+		id, err = res.LastInsertId()
+		return err
+	})
+
+	return int(id), err
+}
+
+// SetPlaylistRules changes the search query of a smart playlist.
+func SetPlaylistRules(ctx context.Context, playlistid int, rules string) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		playlist, err := findPlaylist(tx.QueryRowContext(ctx, stmts.findPlaylist, playlistid))
+		if err != nil {
+			return err
+		}
+		if !playlist.IsSmart() {
+			return ErrNotSmart
+		}
+		_, err = tx.ExecContext(ctx, stmts.updateRules, rules, playlistid)
+		return err
+	})
+}
+
+// RenamePlaylist gives a playlist a new name.
+// Returns ErrPlaylistExists if the name is already taken.
+func RenamePlaylist(ctx context.Context, playlistid int, name string) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := findPlaylist(tx.QueryRowContext(ctx, stmts.findPlaylist, playlistid)); err != nil {
+			return err
+		}
+		if err := checkPlaylistName(ctx, tx, name, playlistid); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, stmts.renamePlaylist, name, playlistid)
+		return err
+	})
+}
+
+// DeletePlaylist removes a playlist and its entries.
+func DeletePlaylist(ctx context.Context, playlistid int) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, stmts.deletePlaylistTracks, playlistid); err != nil {
+			return err
+		}
+		return expectRow(tx.ExecContext(ctx, stmts.deletePlaylist, playlistid))
+	})
+}
+
+// OverwritePlaylist replaces the tracks of a playlist.
+func OverwritePlaylist(ctx context.Context, playlistid int, tracks []globals.Track) error {
+	return editPlaylist(ctx, playlistid, func(ids []int) ([]int, error) {
+		return trackIDs(tracks), nil
+	})
+}
+
+// AppendToPlaylist adds the tracks to the end of a playlist.
+func AppendToPlaylist(ctx context.Context, playlistid int, tracks []globals.Track) error {
+	return editPlaylist(ctx, playlistid, func(ids []int) ([]int, error) {
+		return append(ids, trackIDs(tracks)...), nil
+	})
+}
+
+// AddPlaylistEntry inserts a track at the given position of a playlist,
+// a negative position adds it to the end.
+func AddPlaylistEntry(ctx context.Context, playlistid int, trackid int, position int) error {
+	return editPlaylist(ctx, playlistid, func(ids []int) ([]int, error) {
+		if position < 0 {
+			position = len(ids)
+		}
+		if position > len(ids) {
+			return nil, ErrInvalidPosition
+		}
+		return append(ids[:position], append([]int{trackid}, ids[position:]...)...), nil
+	})
+}
+
+// RemovePlaylistEntry removes the track at the given position from a playlist.
+func RemovePlaylistEntry(ctx context.Context, playlistid int, position int) error {
+	return editPlaylist(ctx, playlistid, func(ids []int) ([]int, error) {
+		if position < 0 || position >= len(ids) {
+			return nil, ErrInvalidPosition
+		}
+		return append(ids[:position], ids[position+1:]...), nil
+	})
+}
+
+// MovePlaylistEntry moves the track at position from to position to.
+func MovePlaylistEntry(ctx context.Context, playlistid int, from int, to int) error {
+	return editPlaylist(ctx, playlistid, func(ids []int) ([]int, error) {
+		if from < 0 || from >= len(ids) || to < 0 || to >= len(ids) {
+			return nil, ErrInvalidPosition
+		}
+		id := ids[from]
+		ids = append(ids[:from], ids[from+1:]...)
+		return append(ids[:to], append([]int{id}, ids[to:]...)...), nil
+	})
+}
+
+// editPlaylist reads the track ids of a playlist in order, lets edit change
+// them and writes them back with fresh positions, all in one transaction.
+func editPlaylist(ctx context.Context, playlistid int, edit func(ids []int) ([]int, error)) error {
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		playlist, err := findPlaylist(tx.QueryRowContext(ctx, stmts.findPlaylist, playlistid))
+		if err != nil {
+			return err
+		}
+		if playlist.IsSmart() {
+			return ErrSmartPlaylist
+		}
+
+		rows, err := tx.QueryContext(ctx, stmts.findPlaylistEntries, playlistid)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int, 0)
+		for rows.Next() {
+			var id int
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		ids, err = edit(ids)
+		if err != nil {
+			return err
+		}
+
+		return writePlaylist(ctx, tx, playlistid, ids)
+	})
+}
+
+// writePlaylist replaces the entries of a playlist with the given tracks
+func writePlaylist(ctx context.Context, tx *sql.Tx, playlistid int, ids []int) error {
+	if _, err := tx.ExecContext(ctx, stmts.deletePlaylistTracks, playlistid); err != nil {
+		return err
+	}
+
+	for position, id := range ids {
+		if _, err := tx.ExecContext(ctx, stmts.insertPlaylistTrack, id, playlistid, position); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPlaylistName returns ErrPlaylistExists if another playlist than the given one has this name
+func checkPlaylistName(ctx context.Context, tx *sql.Tx, name string, playlistid int) error {
+	var existing int
+	err := tx.QueryRowContext(ctx, stmts.findPlaylistByName, name).Scan(&existing)
+	if err == sql.ErrNoRows || (err == nil && existing == playlistid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrPlaylistExists
+}
+
+// expectRow returns ErrPlaylistNotFound when a statement did not change anything
+func expectRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return ErrPlaylistNotFound
+	}
+	return err
+}
+
+// trackIDs returns the ids of the tracks, leaving out tracks that are not
+// in the database
+func trackIDs(tracks []globals.Track) []int {
+	ids := make([]int, 0, len(tracks))
+	for _, track := range tracks {
+		if track.ID > 0 {
+			ids = append(ids, track.ID)
+		}
+	}
+	return ids
+}
+
+// inTransaction runs fn in a transaction that is committed when fn succeeds
+// and rolled back otherwise.
+func inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,85 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// GetTagNeighbours returns the tracks that share the artist, album or genre
+// with the track, or are from around the same year.
+func GetTagNeighbours(ctx context.Context, track globals.Track, years int) ([]globals.Track, error) {
+	clauses := make([]string, 0, 4)
+	args := make([]interface{}, 0, 5)
+
+	tags := []struct {
+		column string
+		value  string
+	}{
+		{"Artist", track.Artist.String},
+		{"Album", track.Album.String},
+		{"Genre", track.Genre.String},
+	}
+	for _, tag := range tags {
+		if tag.value != "" {
+			clauses = append(clauses, "LOWER("+tag.column+") = LOWER(?)")
+			args = append(args, tag.value)
+		}
+	}
+	if track.Year.Valid {
+		clauses = append(clauses, "Year BETWEEN ? AND ?")
+		args = append(args, track.Year.Int64-int64(years), track.Year.Int64+int64(years))
+	}
+
+	if len(clauses) == 0 {
+		return []globals.Track{}, nil
+	}
+	tracks, _, err := QueryTracks(ctx, "("+strings.Join(clauses, " OR ")+")", globals.Page{}, args...)
+	return tracks, err
+}
+
+// GetPlaylistNeighbours counts for every other track in how many playlists it
+// is together with the track.
+func GetPlaylistNeighbours(ctx context.Context, trackid int) (map[int]int, error) {
+	return countNeighbours(ctx, `SELECT b.TrackID, COUNT(DISTINCT b.PlaylistID) 
+		FROM PlaylistEntries a 
+		JOIN PlaylistEntries b ON a.PlaylistID = b.PlaylistID 
+		WHERE a.TrackID = ? AND b.TrackID <> ? 
+		GROUP BY b.TrackID`, trackid, trackid)
+}
+
+// GetSessionNeighbours counts for every other track how often it was played
+// within gap seconds of the track.
+func GetSessionNeighbours(ctx context.Context, trackid int, gap int64) (map[int]int, error) {
+	return countNeighbours(ctx, sessionNeighbours, gap, gap, trackid, trackid)
+}
+
+// sessionNeighbours finds the plays of a track by PlayHistoryTrackID and the
+// plays around them by PlayHistoryPlayedAt
+const sessionNeighbours = `SELECT b.TrackID, COUNT(*) 
+		FROM PlayHistory a 
+		JOIN PlayHistory b ON b.PlayedAt BETWEEN a.PlayedAt - ? AND a.PlayedAt + ? 
+		WHERE a.TrackID = ? AND b.TrackID <> ? 
+		GROUP BY b.TrackID`
+
+// countNeighbours reads rows of a track id and a count into a map
+func countNeighbours(ctx context.Context, query string, args ...interface{}) (map[int]int, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var id, count int
+		if err = rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+
+	return counts, rows.Err()
+}
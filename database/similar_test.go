@@ -0,0 +1,31 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSessionNeighboursUseIndexes(t *testing.T) {
+	openTestDatabase(t)
+
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+sessionNeighbours, 60, 60, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	for _, index := range []string{"PlayHistoryTrackID", "PlayHistoryPlayedAt"} {
+		if !strings.Contains(strings.Join(plan, "\n"), index) {
+			t.Errorf("%s is not used:\n%s", index, strings.Join(plan, "\n"))
+		}
+	}
+}
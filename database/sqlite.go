@@ -0,0 +1,20 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"database/sql"
+)
+
+// openSqlite opens (and if needed creates) the sqlite database in the given file.
+// The schema is created by the migrations.
+func openSqlite(file string) (*sql.DB, error) {
+	dbc, err := sql.Open("sqlite3", "file:"+file+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only supports a single writer, so don't bother with more connections
+	dbc.SetMaxOpenConns(1)
+
+	return dbc, nil
+}
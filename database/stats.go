@@ -0,0 +1,102 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Totals holds the numbers that describe the entire library
+type Totals struct {
+	Tracks      int
+	Plays       int
+	NeverPlayed int
+	Untagged    int
+}
+
+// GetTotals counts the tracks, plays, tracks that were never played and
+// tracks without a title or artist tag.
+func GetTotals(ctx context.Context) (Totals, error) {
+	var totals Totals
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(Plays), 0), 
+		COALESCE(SUM(CASE WHEN Plays = 0 THEN 1 ELSE 0 END), 0), 
+		COALESCE(SUM(CASE WHEN Title IS NULL OR Artist IS NULL THEN 1 ELSE 0 END), 0) 
+		FROM Tracks`).Scan(&totals.Tracks, &totals.Plays, &totals.NeverPlayed, &totals.Untagged)
+	return totals, err
+}
+
+// GetTopGroups returns the n values of a tag (artist, album, genre, year or
+// decade) whose tracks were played most. Tracks without the tag are left out.
+func GetTopGroups(ctx context.Context, tag string, n int) ([]globals.Group, error) {
+	column, ok := groupColumns[tag]
+	if !ok {
+		return nil, ErrUnknownTag
+	}
+
+	return queryGroups(ctx, tag, "SELECT "+column+", COUNT(*), COALESCE(SUM(Plays), 0) FROM Tracks WHERE "+column+
+		" IS NOT NULL GROUP BY "+column+" ORDER BY COALESCE(SUM(Plays), 0) DESC, COUNT(*) DESC LIMIT ?", n)
+}
+
+// GetFormatCounts returns the number of tracks and plays for every supported
+// file format, in the order of globals.GetSupportedFormats.
+func GetFormatCounts(ctx context.Context) ([]globals.Group, error) {
+	groups := make([]globals.Group, 0)
+	for _, format := range globals.GetSupportedFormats() {
+		group := globals.Group{Tag: "format", Value: strings.TrimPrefix(format, ".")}
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(SUM(Plays), 0) FROM Tracks WHERE LOWER(Path) LIKE ?", "%"+format).
+			Scan(&group.Count, &group.Plays)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// GetPlayTimes returns the moment of every recorded play in seconds since 1970
+func GetPlayTimes(ctx context.Context) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT PlayedAt FROM PlayHistory")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make([]int64, 0)
+	for rows.Next() {
+		var t int64
+		if err = rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+
+	return times, rows.Err()
+}
+
+// Play is a single play from the history
+type Play struct {
+	TrackID  int
+	PlayedAt int64
+}
+
+// GetPlaysSince returns the plays from the given moment on, in seconds since 1970
+func GetPlaysSince(ctx context.Context, since int64) ([]Play, error) {
+	rows, err := db.QueryContext(ctx, "SELECT TrackID, PlayedAt FROM PlayHistory WHERE PlayedAt >= ?", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plays := make([]Play, 0)
+	for rows.Next() {
+		var play Play
+		if err = rows.Scan(&play.TrackID, &play.PlayedAt); err != nil {
+			return nil, err
+		}
+		plays = append(plays, play)
+	}
+
+	return plays, rows.Err()
+}
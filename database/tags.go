@@ -0,0 +1,104 @@
+// Package database manages everything that has to do with communicating with the database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// the columns of the tags that can be edited
+var tagColumns = map[string]string{
+	"title":  "Title",
+	"artist": "Artist",
+	"album":  "Album",
+	"genre":  "Genre",
+	"year":   "Year",
+}
+
+// EditTrack changes tags of a track and records every change in the audit log.
+// The changes map a field (title, artist, album, genre or year) to its new
+// value, an empty value removes the tag. Edited fields are no longer marked as
+// inferred, fields that do not change are left alone. written tells whether
+// the changes were also written to the file.
+func EditTrack(ctx context.Context, track globals.Track, changes map[string]string, written bool) error {
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return inTransaction(ctx, func(tx *sql.Tx) error {
+		inferred := strings.Split(track.Inferred.String, ",")
+		now := time.Now().Unix()
+
+		for _, field := range fields {
+			old, value := track.Tag(field), changes[field]
+			if old == value && !track.IsInferred(field) {
+				continue
+			}
+
+			// only what is left is still inferred
+			rest := make([]string, 0, len(inferred))
+			for _, f := range inferred {
+				if f != field && f != "" {
+					rest = append(rest, f)
+				}
+			}
+			inferred = rest
+
+			var column interface{} = StringToSQLNullableString(value)
+			if field == "year" {
+				year, _ := strconv.Atoi(value)
+				column = IntToSQLNullableInt(year)
+			}
+
+			_, err := tx.ExecContext(ctx, "UPDATE Tracks SET "+tagColumns[field]+" = ?, Inferred = ? WHERE TrackID = ?",
+				column, StringToSQLNullableString(strings.Join(inferred, ",")), track.ID)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, stmts.insertTagEdit, track.ID, field, StringToSQLNullableString(old),
+				StringToSQLNullableString(value), now, written)
+			if err != nil {
+				return err
+			}
+		}
+
+		return bumpVersion(ctx, tx)
+	})
+}
+
+// GetTagEdits returns the n latest changes of the audit log for a track, or
+// for all tracks when the ID is 0. The latest change comes first.
+func GetTagEdits(ctx context.Context, trackid int, n int) ([]globals.TagEdit, error) {
+	var rows *sql.Rows
+	var err error
+	if trackid == 0 {
+		rows, err = db.QueryContext(ctx, stmts.findTagEdits, n)
+	} else {
+		rows, err = db.QueryContext(ctx, stmts.findTrackTagEdits, trackid, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := make([]globals.TagEdit, 0)
+	for rows.Next() {
+		var edit globals.TagEdit
+		err = rows.Scan(&edit.ID, &edit.TrackID, &edit.Field, &edit.Old, &edit.New, &edit.EditedAt, &edit.WrittenBack)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	return edits, rows.Err()
+}
@@ -4,6 +4,8 @@ package globals
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 )
 
 // Root is the root folder where the player is initialized
@@ -13,12 +15,19 @@ var Root string
 type ConfigFile struct {
 	Mode     string `json:"mode"`
 	Database struct {
+		Driver   string `json:"driver"`
+		File     string `json:"file"`
 		User     string `json:"user"`
 		Password string `json:"password"`
 		Database string `json:"database"`
 		Host     string `json:"host"`
 		Port     int    `json:"port"`
+		Migrate  bool   `json:"migrate"`
 	} `json:"database"`
+	Patterns     []string `json:"patterns"`
+	Cache        string   `json:"cache"`
+	StatsOutput  string   `json:"statsOutput"`
+	Autofill     string   `json:"autofill"`
 	Highlight    string `json:"highlight"`
 	Quiet        bool   `json:"quiet"`
 	Logging      bool   `json:"logging"`
@@ -35,6 +44,35 @@ type ConfigFile struct {
 		Enable bool   `json:"enable"`
 		Port   string `json:"port"`
 	} `json:"serial"`
+	Auth struct {
+		Enable     bool      `json:"enable"`
+		Anonymous  string    `json:"anonymous"`
+		GuestLimit int       `json:"guestLimit"`
+		Accounts   []Account `json:"accounts"`
+	} `json:"auth"`
+	Limits struct {
+		Enable  bool             `json:"enable"`
+		Actions map[string]Limit `json:"actions"`
+		Strikes int              `json:"strikes"`
+		Ban     int              `json:"ban"`
+	} `json:"limits"`
+}
+
+// Limit is how many requests of a kind a client of the webserver or web
+// interface may make in a number of seconds.
+type Limit struct {
+	Requests int `json:"requests"`
+	Seconds  int `json:"seconds"`
+}
+
+// Account is someone who may use the webserver and web interface. They log
+// in with a password (a hash made with -m password), use a token in scripts,
+// or both. The role is guest, dj or admin.
+type Account struct {
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
 }
 
 // Folder is a struct that holds all folder info, this correlates directly
@@ -50,16 +88,127 @@ type Folder struct {
 // to what is in the database. It is also used in filesystem mode but only to
 // hold the meta tags.
 type Track struct {
-	ID       int
-	Path     string
-	FolderID int
-	Title    sql.NullString
-	Album    sql.NullString
-	Artist   sql.NullString
-	Genre    sql.NullString
-	Year     sql.NullInt64
-	Plays    int
-	Error    bool
+	ID        int
+	Path      string
+	FolderID  int
+	Title     sql.NullString
+	Album     sql.NullString
+	Artist    sql.NullString
+	Genre     sql.NullString
+	Year      sql.NullInt64
+	Plays     int
+	Rating    int
+	Favourite bool
+	Inferred  sql.NullString
+	Error     bool
+}
+
+// IsInferred reports whether the given field (artist, album, title, genre
+// or year) was inferred from the path instead of read from the tags.
+func (track Track) IsInferred(field string) bool {
+	return Contains(strings.Split(track.Inferred.String, ","), field)
+}
+
+// Tag returns the value of a field (artist, album, title, genre or year) as
+// text, an empty string when the track does not have it.
+func (track Track) Tag(field string) string {
+	switch field {
+	case "title":
+		return track.Title.String
+	case "artist":
+		return track.Artist.String
+	case "album":
+		return track.Album.String
+	case "genre":
+		return track.Genre.String
+	case "year":
+		if track.Year.Valid {
+			return strconv.FormatInt(track.Year.Int64, 10)
+		}
+	}
+	return ""
+}
+
+// Playlist is a struct that holds the info of a saved playlist, with the
+// number of tracks in it but without the tracks themselves. Smart playlists
+// have Rules, a search query that selects their tracks, instead of tracks.
+type Playlist struct {
+	ID     int
+	Name   string
+	Rules  string
+	Tracks int
+}
+
+// IsSmart reports whether the playlist is defined by rules instead of tracks.
+func (playlist Playlist) IsSmart() bool {
+	return playlist.Rules != ""
+}
+
+// TagEdit is a change to a single tag of a track as it is kept in the audit
+// log, EditedAt is in seconds since 1970. WrittenBack tells whether the change
+// was also written to the file.
+type TagEdit struct {
+	ID          int
+	TrackID     int
+	Field       string
+	Old         sql.NullString
+	New         sql.NullString
+	EditedAt    int64
+	WrittenBack bool
+}
+
+// Ban is an entry of the ban list of the jukebox. Kind is track, artist, genre
+// or folder and Value the track ID, the name of the artist or genre or the
+// path of the folder. CreatedAt is in seconds since 1970.
+type Ban struct {
+	ID        int
+	Kind      string
+	Value     string
+	CreatedAt int64
+}
+
+// Health tells whether the database can be reached, since when (in seconds
+// since 1970) and how many plays are waiting to be written to it.
+type Health struct {
+	Online       bool
+	Since        int64
+	PendingPlays int
+}
+
+// Group is a distinct value of a tag (artist, album, genre, year or decade)
+// together with the number of tracks that have it and how often they were
+// played. It is used for browsing by tag, where a list of groups describes the
+// current selection, and for statistics. An empty Value stands for tracks
+// without this tag.
+type Group struct {
+	Tag   string
+	Value string
+	Count int
+	Plays int
+}
+
+// Page selects a part of a list: at most Limit items, starting at Offset. A
+// Limit of 0 selects everything from the offset on, so the zero Page is the
+// entire list.
+type Page struct {
+	Offset int
+	Limit  int
+}
+
+// Bounds returns the start and end of the page within a list of n items. A
+// negative offset starts at the beginning and a negative limit takes the rest,
+// like no limit.
+func (page Page) Bounds(n int) (int, int) {
+	start := page.Offset
+	if start < 0 {
+		start = 0
+	} else if start > n {
+		start = n
+	}
+	if page.Limit <= 0 || start+page.Limit > n {
+		return start, n
+	}
+	return start, start + page.Limit
 }
 
 // Config is the variable that holder the config file
@@ -0,0 +1,27 @@
+package globals
+
+import "testing"
+
+func TestPageBounds(t *testing.T) {
+	for _, test := range []struct {
+		page       Page
+		n          int
+		start, end int
+	}{
+		{Page{}, 5, 0, 5},
+		{Page{Offset: 1, Limit: 2}, 5, 1, 3},
+		{Page{Offset: 4, Limit: 10}, 5, 4, 5},
+		{Page{Offset: 9}, 5, 5, 5},
+		{Page{Offset: -3, Limit: 2}, 5, 0, 2},
+		{Page{Offset: 2, Limit: -1}, 5, 2, 5},
+		{Page{Offset: -1, Limit: -10}, 5, 0, 5},
+		{Page{Offset: -1, Limit: -10}, 0, 0, 0},
+	} {
+		start, end := test.page.Bounds(test.n)
+		if start != test.start || end != test.end {
+			t.Errorf("%+v of %d: got %d..%d, want %d..%d", test.page, test.n, start, end, test.start, test.end)
+		}
+		// the bounds should always be usable on a slice
+		_ = make([]int, test.n)[start:end]
+	}
+}
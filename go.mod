@@ -1,6 +1,6 @@
 module github.com/MeesCode/mmjs
 
-go 1.15
+go 1.16
 
 require (
 	github.com/adrg/libvlc-go/v3 v3.1.5
@@ -8,9 +8,10 @@ require (
 	github.com/gdamore/tcell/v2 v2.4.1-0.20210905002822-f057f0a857a1
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gorilla/websocket v1.4.2
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/rivo/tview v0.0.0-20211001102648-5508f4b00266
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 	golang.org/x/sys v0.0.0-20211013075003-97ac67df715c // indirect
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
-	golang.org/x/text v0.3.7 // indirect
+	golang.org/x/text v0.3.7
 )
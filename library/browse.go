@@ -0,0 +1,85 @@
+package library
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/search"
+)
+
+// Views are the ways to browse the library by tag. Every view lists the tags
+// that are chosen one after the other, after the last one only tracks remain.
+var Views = map[string][]string{
+	"artists": {"artist", "album"},
+	"genres":  {"genre", "artist", "album"},
+	"years":   {"decade", "year", "album"},
+}
+
+// ViewNames lists the views in the order they are cycled through,
+// folders is the normal directory tree.
+var ViewNames = []string{"folders", "artists", "genres", "years"}
+
+// valueOf returns the value of a tag of a track, empty if it is unknown
+func valueOf(track globals.Track, tag string) string {
+	switch tag {
+	case "artist":
+		return track.Artist.String
+	case "album":
+		return track.Album.String
+	case "genre":
+		return track.Genre.String
+	case "year":
+		if track.Year.Valid {
+			return strconv.FormatInt(track.Year.Int64, 10)
+		}
+	case "decade":
+		if track.Year.Valid {
+			return strconv.FormatInt(track.Year.Int64-track.Year.Int64%10, 10)
+		}
+	}
+	return ""
+}
+
+// inSelection reports whether the track has every tag value in the selection
+func inSelection(track globals.Track, selection []globals.Group) bool {
+	for _, group := range selection {
+		if valueOf(track, group.Tag) != group.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupTracks counts the values of a tag among the tracks in the selection,
+// this is used when there is no database to do it.
+func groupTracks(tracks []globals.Track, tag string, selection []globals.Group) []globals.Group {
+	counts := make(map[string]int)
+	for _, track := range tracks {
+		if inSelection(track, selection) {
+			counts[valueOf(track, tag)]++
+		}
+	}
+
+	groups := make([]globals.Group, 0, len(counts))
+	for value, count := range counts {
+		groups = append(groups, globals.Group{Tag: tag, Value: value, Count: count})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return search.Fold(groups[i].Value) < search.Fold(groups[j].Value)
+	})
+	return groups
+}
+
+// selectTracks returns the tracks in the selection, sorted by artist and album
+func selectTracks(tracks []globals.Track, selection []globals.Group) []globals.Track {
+	selected := make([]globals.Track, 0)
+	for _, track := range tracks {
+		if inSelection(track, selection) {
+			selected = append(selected, track)
+		}
+	}
+	search.Sort(selected)
+	return selected
+}
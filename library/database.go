@@ -0,0 +1,507 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/metadata"
+	"github.com/MeesCode/mmjs/recommend"
+	"github.com/MeesCode/mmjs/search"
+	"github.com/MeesCode/mmjs/stats"
+)
+
+// databaseLibrary reads the library from the database that was filled
+// by index mode.
+type databaseLibrary struct {
+	index searchIndex
+}
+
+func newDatabase() *databaseLibrary {
+	return &databaseLibrary{}
+}
+
+// the root folder always has id 1
+func (l *databaseLibrary) Root() (globals.Folder, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetFolderByID(ctx, 1)
+}
+
+func (l *databaseLibrary) Folder(rpath string) (globals.Folder, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	folder, err := database.GetFolderByPath(ctx, path.Clean("/"+rpath))
+	if err == sql.ErrNoRows {
+		return folder, ErrFolderNotFound
+	}
+	return folder, err
+}
+
+func (l *databaseLibrary) Parent(folder globals.Folder) (globals.Folder, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetFolderByID(ctx, folder.ParentID)
+}
+
+func (l *databaseLibrary) Folders(folder globals.Folder, page globals.Page) ([]globals.Folder, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetFoldersByParentID(ctx, folder.ID, page)
+}
+
+func (l *databaseLibrary) Tracks(folder globals.Folder, page globals.Page) ([]globals.Track, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetTracksByFolderID(ctx, folder.ID, page)
+}
+
+func (l *databaseLibrary) AllTracks(folder globals.Folder) ([]globals.Track, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return l.allTracks(ctx, folder)
+}
+
+// allTracks collects the tracks of a folder and its children within a single timeout
+func (l *databaseLibrary) allTracks(ctx context.Context, folder globals.Folder) ([]globals.Track, error) {
+	tracks, _, err := database.GetTracksByFolderID(ctx, folder.ID, globals.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	children, _, err := database.GetFoldersByParentID(ctx, folder.ID, globals.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	// add children recursively
+	for _, child := range children {
+		childTracks, err := l.allTracks(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, childTracks...)
+	}
+
+	return tracks, nil
+}
+
+func (l *databaseLibrary) Groups(tag string, selection []globals.Group, page globals.Page) ([]globals.Group, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetGroups(ctx, tag, selection, page)
+}
+
+func (l *databaseLibrary) Selection(selection []globals.Group, page globals.Page) ([]globals.Track, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetTracksInSelection(ctx, selection, page)
+}
+
+func (l *databaseLibrary) Track(id int) (globals.Track, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	track, err := database.GetTrackByID(ctx, id)
+	if err == sql.ErrNoRows {
+		return track, ErrTrackNotFound
+	}
+	return track, err
+}
+
+// Search runs a query such as "artist:queen year:1975..1980 -live". The filters
+// are evaluated by the database and the free text is ranked by the search index.
+func (l *databaseLibrary) Search(term string, page globals.Page) ([]globals.Track, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return l.search(ctx, term, page)
+}
+
+// search runs a query within the given context, smart playlists use it too.
+// Queries with only numeric filters are paged by the database. Text filters
+// are narrowed down by the database and checked folded with Match, and ranked
+// and sorted results have to be complete before a page can be taken from them.
+func (l *databaseLibrary) search(ctx context.Context, term string, page globals.Page) ([]globals.Track, int, error) {
+	query, err := search.Parse(term)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if query.IsEmpty() {
+		return []globals.Track{}, 0, nil
+	}
+
+	if query.Text == "" && query.Order == "" && query.Exact() {
+		where, args := query.SQL()
+		if query.Limit == 0 {
+			return database.QueryAllowedTracks(ctx, where, page, args...)
+		}
+
+		tracks, _, err := database.QueryAllowedTracks(ctx, where, globals.Page{Limit: query.Limit}, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		tracks, total := pageTracks(tracks, page)
+		return tracks, total, nil
+	}
+
+	banned, err := database.GetBannedTrackIDs(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the tracks that satisfy the filters, nil when there are none
+	var matching map[int]bool
+	if len(query.Filters) > 0 || query.Text == "" {
+		where, args := query.SQL()
+		tracks, _, err := database.QueryTracks(ctx, where, globals.Page{}, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		tracks = query.Filter(tracks)
+		if query.Text == "" {
+			tracks, total := pageTracks(query.Arrange(withoutBanned(tracks, banned)), page)
+			return tracks, total, nil
+		}
+
+		matching = make(map[int]bool, len(tracks))
+		for _, track := range tracks {
+			matching[track.ID] = true
+		}
+	}
+
+	// the version changes when the library is indexed or tags are edited
+	version, err := database.LibraryVersion(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	engine, err := l.index.get(version, func() ([]globals.Track, error) {
+		return database.GetAllTracks(ctx)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tracks, total := pageTracks(query.Arrange(query.Rank(engine, func(track globals.Track) bool {
+		return (matching == nil || matching[track.ID]) && !banned[track.ID]
+	})), page)
+	return tracks, total, nil
+}
+
+// Similar recommends tracks from the shared tags and how often tracks were
+// together in playlists and listening sessions.
+func (l *databaseLibrary) Similar(id int, n int) ([]globals.Track, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	track, err := database.GetTrackByID(ctx, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrTrackNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := database.GetTagNeighbours(ctx, track, recommend.YearDistance)
+	if err != nil {
+		return nil, err
+	}
+
+	var together recommend.Together
+	if together.Playlists, err = database.GetPlaylistNeighbours(ctx, id); err != nil {
+		return nil, err
+	}
+	if together.Sessions, err = database.GetSessionNeighbours(ctx, id, recommend.SessionGap); err != nil {
+		return nil, err
+	}
+
+	// tracks that only share playlists or sessions are not candidates yet, the
+	// history may still have tracks that were removed from the library
+	known := make(map[int]bool, len(candidates))
+	for _, candidate := range candidates {
+		known[candidate.ID] = true
+	}
+	missing := make([]int, 0)
+	for _, counts := range []map[int]int{together.Playlists, together.Sessions} {
+		for other := range counts {
+			if !known[other] {
+				known[other] = true
+				missing = append(missing, other)
+			}
+		}
+	}
+	sort.Ints(missing)
+	others, err := database.GetTracksByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, others...)
+
+	banned, err := database.GetBannedTrackIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return recommend.Similar(track, withoutBanned(candidates, banned), together, n), nil
+}
+
+// banned tracks are left out by the database
+func (l *databaseLibrary) Random(n int) ([]globals.Track, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetRandomTracks(ctx, n)
+}
+
+func (l *databaseLibrary) Popular(window string, n int) ([]globals.Track, error) {
+	w, ok := stats.FindWindow(window)
+	if !ok {
+		return nil, ErrUnknownWindow
+	}
+	ctx, cancel := database.Context()
+	defer cancel()
+	return stats.Trending(ctx, w, n)
+}
+
+func (l *databaseLibrary) IncrementPlays(id int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.IncrementPlayCounter(ctx, id)
+}
+
+// the search index holds copies of the tracks, so it is rebuilt after a change
+func (l *databaseLibrary) SetRating(id int, rating int) error {
+	if rating < 0 || rating > 5 {
+		return ErrInvalidRating
+	}
+	ctx, cancel := database.Context()
+	defer cancel()
+	if err := database.SetRating(ctx, id, rating); err == sql.ErrNoRows {
+		return ErrTrackNotFound
+	} else if err != nil {
+		return err
+	}
+	l.index.invalidate()
+	return nil
+}
+
+func (l *databaseLibrary) SetFavourite(id int, favourite bool) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	if err := database.SetFavourite(ctx, id, favourite); err == sql.ErrNoRows {
+		return ErrTrackNotFound
+	} else if err != nil {
+		return err
+	}
+	l.index.invalidate()
+	return nil
+}
+
+// EditTags changes the tracks one by one. A file that can not be written is
+// logged and the database is changed anyway, so the edit is not lost.
+func (l *databaseLibrary) EditTags(ids []int, changes map[string]string, writeBack bool) error {
+	if err := metadata.CheckChanges(changes); err != nil {
+		return err
+	}
+	defer l.index.invalidate()
+
+	failed := 0
+	for _, id := range ids {
+		if err := l.editTrack(id, changes, writeBack); err == ErrWriteBack {
+			failed++
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d files", ErrWriteBack, failed, len(ids))
+	}
+	return nil
+}
+
+// editTrack edits a single track, every track gets a timeout of its own
+// since writing the files takes a while. Returns ErrWriteBack when only the
+// file could not be written.
+func (l *databaseLibrary) editTrack(id int, changes map[string]string, writeBack bool) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	track, err := database.GetTrackByID(ctx, id)
+	if err == sql.ErrNoRows {
+		return ErrTrackNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	if writeBack {
+		if err = metadata.WriteTags(path.Join(globals.Root, track.Path), changes); err != nil {
+			log.Println("could not write tags to", track.Path, err)
+			failed = ErrWriteBack
+		}
+	}
+
+	if err := database.EditTrack(ctx, track, changes, writeBack && failed == nil); err != nil {
+		return err
+	}
+	return failed
+}
+
+func (l *databaseLibrary) Bans() ([]globals.Ban, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetBans(ctx)
+}
+
+func (l *databaseLibrary) Ban(kind string, value string) (int, error) {
+	value, err := checkBan(kind, value)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	if kind == "track" {
+		id, _ := strconv.Atoi(value)
+		_, err := database.GetTrackByID(ctx, id)
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidBan
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return database.AddBan(ctx, kind, value)
+}
+
+func (l *databaseLibrary) Unban(id int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.RemoveBan(ctx, id)
+}
+
+func (l *databaseLibrary) Allowed(tracks []globals.Track) ([]globals.Track, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	banned, err := database.GetBannedTrackIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return withoutBanned(tracks, banned), nil
+}
+
+func (l *databaseLibrary) TagEdits(id int, n int) ([]globals.TagEdit, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetTagEdits(ctx, id, n)
+}
+
+func (l *databaseLibrary) Stats(top int) (stats.Report, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	report, err := stats.Build(ctx, top)
+	report.Database = database.GetHealth()
+	return report, err
+}
+
+func (l *databaseLibrary) Health() globals.Health {
+	return database.GetHealth()
+}
+
+func (l *databaseLibrary) Playlists() ([]globals.Playlist, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.GetPlaylists(ctx)
+}
+
+// PlaylistTracks returns the entries of a playlist, or searches for the tracks
+// of a smart playlist.
+func (l *databaseLibrary) PlaylistTracks(id int, page globals.Page) ([]globals.Track, int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	playlist, err := database.GetPlaylist(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if playlist.IsSmart() {
+		return l.search(ctx, playlist.Rules, page)
+	}
+	return database.GetPlaylistTracks(ctx, id, page)
+}
+
+func (l *databaseLibrary) SavePlaylist(name string, tracks []globals.Track) (int, error) {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.SavePlaylist(ctx, name, tracks)
+}
+
+func (l *databaseLibrary) SaveSmartPlaylist(name string, rules string) (int, error) {
+	if err := CheckRules(rules); err != nil {
+		return 0, err
+	}
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.SaveSmartPlaylist(ctx, name, rules)
+}
+
+func (l *databaseLibrary) SetPlaylistRules(id int, rules string) error {
+	if err := CheckRules(rules); err != nil {
+		return err
+	}
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.SetPlaylistRules(ctx, id, rules)
+}
+
+func (l *databaseLibrary) RenamePlaylist(id int, name string) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.RenamePlaylist(ctx, id, name)
+}
+
+func (l *databaseLibrary) DeletePlaylist(id int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.DeletePlaylist(ctx, id)
+}
+
+func (l *databaseLibrary) OverwritePlaylist(id int, tracks []globals.Track) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.OverwritePlaylist(ctx, id, tracks)
+}
+
+func (l *databaseLibrary) AppendToPlaylist(id int, tracks []globals.Track) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.AppendToPlaylist(ctx, id, tracks)
+}
+
+func (l *databaseLibrary) AddPlaylistEntry(id int, trackID int, position int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.AddPlaylistEntry(ctx, id, trackID, position)
+}
+
+func (l *databaseLibrary) RemovePlaylistEntry(id int, position int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.RemovePlaylistEntry(ctx, id, position)
+}
+
+func (l *databaseLibrary) MovePlaylistEntry(id int, from int, to int) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+	return database.MovePlaylistEntry(ctx, id, from, to)
+}
@@ -0,0 +1,198 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/search"
+)
+
+// openTestDatabase creates an empty sqlite library with the tracks, given as
+// artist and title, in a single folder. The ids of the tracks start at 1.
+func openTestDatabase(t *testing.T, tracks ...[2]string) *sql.DB {
+	t.Helper()
+	globals.Config.Database.Driver = "sqlite"
+	globals.Config.Database.File = filepath.Join(t.TempDir(), "mmjs.db")
+	globals.Config.Database.Migrate = true
+
+	db, err := database.Warmup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("INSERT INTO Folders (Path, ParentID) VALUES ('/', 0)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range tracks {
+		_, err := db.Exec("INSERT INTO Tracks (Path, FolderID, Artist, Title) VALUES (?, 1, ?, ?)",
+			"/"+track[0]+" - "+track[1]+".mp3", track[0], track[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestSimilarSkipsRemovedTracks(t *testing.T) {
+	db := openTestDatabase(t, [2]string{"Queen", "Innuendo"}, [2]string{"Abba", "Waterloo"})
+
+	// track 99 was played in the same session but is no longer in the library
+	for _, play := range [][2]int{{1, 1000}, {99, 1100}, {2, 1200}} {
+		if _, err := db.Exec("INSERT INTO PlayHistory (TrackID, PlayedAt) VALUES (?, ?)", play[0], play[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracks, err := newDatabase().Similar(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != 2 {
+		t.Fatalf("got %v, want only track 2", tracks)
+	}
+}
+
+func TestSearchFiltersLikeFilesystemMode(t *testing.T) {
+	openTestDatabase(t,
+		[2]string{"Motörhead", "Ace of Spades"},
+		[2]string{"Beyoncé", "Halo"},
+		[2]string{"Die Ärzte", "Schrei nach Liebe"},
+		[2]string{"Straßenjungs", "Dumm geboren"},
+		[2]string{"50%", "Half"},
+		[2]string{"Queen", "Innuendo"},
+	)
+
+	for query, want := range map[string][]int{
+		"artist:motorhead":           {1},
+		"artist:Motörhead":           {1},
+		"artist:BEYONCE":             {2},
+		"artist:ärzte":               {3},
+		"artist:strassenjungs":       {4},
+		"artist:Straßen":             {4},
+		"artist:%":                   {5},
+		"title:h_lo":                 {},
+		"-artist:motorhead genre:%":  {},
+		"-artist:motorhead -title:a": {6, 4},
+	} {
+		tracks, total, err := newDatabase().Search(query, globals.Page{})
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		ids := make([]int, 0)
+		for _, track := range tracks {
+			ids = append(ids, track.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want) || total != len(want) {
+			t.Errorf("%s: got %v (total %d), want %v", query, ids, total, want)
+		}
+	}
+}
+
+func TestSQLNarrowsDownTextFilters(t *testing.T) {
+	openTestDatabase(t,
+		[2]string{"Motörhead", "Ace of Spades"},
+		[2]string{"Queen", "Innuendo"},
+		[2]string{"Toto", "Africa"},
+	)
+
+	// ascii is checked by the database, Motörhead is left to Match
+	for term, want := range map[string][]int{
+		"artist:queen":  {1, 2},
+		"-artist:queen": {1, 3},
+		"title:africa":  {3},
+		"title:AFR":     {3},
+		"-title:a":      {2},
+		"path:%":        {1},
+	} {
+		query, err := search.Parse(term)
+		if err != nil {
+			t.Fatalf("%s: %s", term, err)
+		}
+		where, args := query.SQL()
+		tracks, _, err := database.QueryTracks(context.Background(), where, globals.Page{}, args...)
+		if err != nil {
+			t.Fatalf("%s: %s", term, err)
+		}
+		ids := make([]int, 0)
+		for _, track := range tracks {
+			ids = append(ids, track.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("%s: the database selected %v, want %v", term, ids, want)
+		}
+	}
+}
+
+func TestSearchSeesChangesOfOtherProcesses(t *testing.T) {
+	openTestDatabase(t, [2]string{"Queen", "Innuendo"})
+	jukebox := newDatabase()
+
+	count := func(term string) int {
+		t.Helper()
+		_, total, err := jukebox.Search(term, globals.Page{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return total
+	}
+	if count("innuendo") != 1 || count("bijou") != 0 {
+		t.Fatal("the index does not start with the library")
+	}
+
+	// an index run with mmjs -m index
+	globals.Root = t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(globals.Root, "Bijou.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Index(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count("bijou") != 1 {
+		t.Error("a new track is not found after indexing")
+	}
+
+	// a tag edit by another instance
+	if err := newDatabase().EditTags([]int{1}, map[string]string{"title": "Headlong"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if count("headlong") != 1 {
+		t.Error("an edited track is not found by its new title")
+	}
+
+	// bans are left out on every search, the index does not know about them
+	if _, err := newDatabase().Ban("artist", "Queen"); err != nil {
+		t.Fatal(err)
+	}
+	if count("headlong") != 0 {
+		t.Error("a banned track is still found")
+	}
+}
+
+func TestRateUnknownTrack(t *testing.T) {
+	openTestDatabase(t, [2]string{"Queen", "Innuendo"})
+	l := newDatabase()
+
+	if err := l.SetRating(99, 3); err != ErrTrackNotFound {
+		t.Errorf("rating an unknown track gave %v", err)
+	}
+	if err := l.SetFavourite(99, true); err != ErrTrackNotFound {
+		t.Errorf("a favourite unknown track gave %v", err)
+	}
+
+	// setting the same value twice changes nothing, but the track exists
+	for i := 0; i < 2; i++ {
+		if err := l.SetRating(1, 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.SetFavourite(1, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package library
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/metadata"
+	"github.com/MeesCode/mmjs/recommend"
+	"github.com/MeesCode/mmjs/search"
+	"github.com/MeesCode/mmjs/stats"
+)
+
+// filesystemLibrary reads the library directly from the filesystem. Folder
+// paths are relative to globals.Root, just like in the database.
+type filesystemLibrary struct {
+	// tracks get an ID the first time they are seen so they can
+	// be referred to the same way as tracks in the database
+	lock  sync.Mutex
+	ids   map[string]int
+	paths []string
+	index searchIndex
+}
+
+func newFilesystem() *filesystemLibrary {
+	return &filesystemLibrary{ids: make(map[string]int)}
+}
+
+// playable reports whether the file has one of the supported extensions
+func playable(file string) bool {
+	return globals.Contains(globals.GetSupportedFormats(), strings.ToLower(path.Ext(file)))
+}
+
+// readTrack reads the metadata of a file (relative to the root) through
+// the metadata cache.
+func (l *filesystemLibrary) readTrack(rpath string) globals.Track {
+	return l.identify(metadata.Lookup(rpath))
+}
+
+// identify gives the track an ID. If no title is found the filename is used instead.
+func (l *filesystemLibrary) identify(track globals.Track) globals.Track {
+	if !track.Title.Valid {
+		track.Title = sql.NullString{String: path.Base(track.Path), Valid: true}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	id, ok := l.ids[track.Path]
+	if !ok {
+		l.paths = append(l.paths, track.Path)
+		id = len(l.paths)
+		l.ids[track.Path] = id
+	}
+	track.ID = id
+
+	return track
+}
+
+// everything returns every track in the library. Once the metadata cache is
+// built it is used, otherwise the entire filesystem has to be read.
+func (l *filesystemLibrary) everything() ([]globals.Track, error) {
+	if metadata.CacheReady() {
+		tracks := metadata.Cached()
+		for i := range tracks {
+			tracks[i] = l.identify(tracks[i])
+		}
+		return tracks, nil
+	}
+
+	root, _ := l.Root()
+	return l.AllTracks(root)
+}
+
+// walk calls fn for every playable file inside the folder and its children,
+// hidden folders are skipped entirely.
+func walk(folder globals.Folder, fn func(rpath string)) error {
+	root := path.Join(globals.Root, folder.Path)
+	return filepath.Walk(root,
+		func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// skip hidden folders and files
+			if strings.HasPrefix(info.Name(), ".") && file != root {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !info.IsDir() && playable(file) {
+				fn(path.Clean(file[len(globals.Root):]))
+			}
+
+			return nil
+		})
+}
+
+func (l *filesystemLibrary) Root() (globals.Folder, error) {
+	return globals.Folder{ID: -1, Path: "/", ParentID: -1}, nil
+}
+
+// hidden folders can not be browsed, like in Folders
+func (l *filesystemLibrary) Folder(rpath string) (globals.Folder, error) {
+	rpath = path.Clean("/" + rpath)
+	info, err := os.Stat(path.Join(globals.Root, rpath))
+	if err != nil || !info.IsDir() || strings.Contains(rpath, "/.") {
+		return globals.Folder{}, ErrFolderNotFound
+	}
+	return globals.Folder{ID: -1, Path: rpath, ParentID: -1}, nil
+}
+
+func (l *filesystemLibrary) Parent(folder globals.Folder) (globals.Folder, error) {
+	return globals.Folder{ID: -1, Path: path.Dir(folder.Path), ParentID: -1}, nil
+}
+
+// the directory has to be read entirely before a page can be taken from it
+func (l *filesystemLibrary) Folders(folder globals.Folder, page globals.Page) ([]globals.Folder, int, error) {
+	files, err := ioutil.ReadDir(path.Join(globals.Root, folder.Path))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	folders := make([]globals.Folder, 0)
+	for _, file := range files {
+
+		//ignore hidden folders
+		if file.IsDir() && file.Name()[0] != '.' {
+			folders = append(folders, globals.Folder{
+				ID:       -1,
+				Path:     path.Join(folder.Path, file.Name()),
+				ParentID: -1})
+		}
+	}
+
+	folders, total := pageFolders(folders, page)
+	return folders, total, nil
+}
+
+func (l *filesystemLibrary) Tracks(folder globals.Folder, page globals.Page) ([]globals.Track, int, error) {
+	files, err := ioutil.ReadDir(path.Join(globals.Root, folder.Path))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tracks := make([]globals.Track, 0)
+	for _, file := range files {
+
+		//ignore hidden files
+		if file.IsDir() || file.Name()[0] == '.' || !playable(file.Name()) {
+			continue
+		}
+
+		var track = l.readTrack(path.Join(folder.Path, file.Name()))
+
+		//check for duplicates
+		dup := false
+		for _, t := range tracks {
+			if track.Artist == t.Artist && track.Title == t.Title {
+				dup = true
+				break
+			}
+		}
+
+		if !dup {
+			tracks = append(tracks, track)
+		}
+	}
+
+	tracks, total := pageTracks(tracks, page)
+	return tracks, total, nil
+}
+
+func (l *filesystemLibrary) AllTracks(folder globals.Folder) ([]globals.Track, error) {
+	tracks := make([]globals.Track, 0)
+	err := walk(folder, func(rpath string) {
+		tracks = append(tracks, l.readTrack(rpath))
+	})
+	return tracks, err
+}
+
+func (l *filesystemLibrary) Groups(tag string, selection []globals.Group, page globals.Page) ([]globals.Group, int, error) {
+	tracks, err := l.everything()
+	if err != nil {
+		return nil, 0, err
+	}
+	groups, total := pageGroups(groupTracks(tracks, tag, selection), page)
+	return groups, total, nil
+}
+
+func (l *filesystemLibrary) Selection(selection []globals.Group, page globals.Page) ([]globals.Track, int, error) {
+	tracks, err := l.everything()
+	if err != nil {
+		return nil, 0, err
+	}
+	tracks, total := pageTracks(selectTracks(tracks, selection), page)
+	return tracks, total, nil
+}
+
+func (l *filesystemLibrary) Track(id int) (globals.Track, error) {
+	l.lock.Lock()
+	if id < 1 || id > len(l.paths) {
+		l.lock.Unlock()
+		return globals.Track{}, ErrTrackNotFound
+	}
+	rpath := l.paths[id-1]
+	l.lock.Unlock()
+
+	return l.readTrack(rpath), nil
+}
+
+// Search runs a query such as "artist:queen year:1975..1980 -live". The filters
+// are evaluated on the cached metadata and the free text is ranked by the search
+// index, which is rebuilt whenever the metadata cache changed.
+func (l *filesystemLibrary) Search(term string, page globals.Page) ([]globals.Track, int, error) {
+	query, err := search.Parse(term)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if query.IsEmpty() {
+		return []globals.Track{}, 0, nil
+	}
+
+	if query.Text == "" {
+		tracks, err := l.everything()
+		if err != nil {
+			return nil, 0, err
+		}
+		tracks, total := pageTracks(query.Arrange(query.Filter(tracks)), page)
+		return tracks, total, nil
+	}
+
+	version := metadata.CacheChanges()
+	if !metadata.CacheReady() {
+		version = -1
+	}
+
+	engine, err := l.index.get(version, l.everything)
+	if err != nil {
+		return nil, 0, err
+	}
+	tracks, total := pageTracks(query.Arrange(query.Rank(engine, query.Match)), page)
+	return tracks, total, nil
+}
+
+// Similar recommends tracks from the tags they share, there are no playlists
+// or listening sessions in filesystem mode.
+func (l *filesystemLibrary) Similar(id int, n int) ([]globals.Track, error) {
+	track, err := l.Track(id)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := l.everything()
+	if err != nil {
+		return nil, err
+	}
+
+	return recommend.Similar(track, candidates, recommend.Together{}, n), nil
+}
+
+// Random picks n tracks from the entire library.
+func (l *filesystemLibrary) Random(n int) ([]globals.Track, error) {
+	if n < 1 {
+		return nil, nil
+	}
+
+	all, err := l.everything()
+	if err != nil {
+		return nil, err
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random.Shuffle(len(all), func(i, j int) {
+		all[i], all[j] = all[j], all[i]
+	})
+
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all, nil
+}
+
+// play counts are not kept in filesystem mode
+
+func (l *filesystemLibrary) Popular(window string, n int) ([]globals.Track, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *filesystemLibrary) IncrementPlays(id int) error {
+	return ErrUnsupported
+}
+
+// ratings can only be stored in the database
+
+func (l *filesystemLibrary) SetRating(id int, rating int) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) SetFavourite(id int, favourite bool) error {
+	return ErrUnsupported
+}
+
+// edited tags are kept in the database, the files themselves can be
+// edited with any tag editor
+
+func (l *filesystemLibrary) EditTags(ids []int, changes map[string]string, writeBack bool) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) TagEdits(id int, n int) ([]globals.TagEdit, error) {
+	return nil, ErrUnsupported
+}
+
+// the ban list is kept in the database, without it nothing is banned
+
+func (l *filesystemLibrary) Bans() ([]globals.Ban, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *filesystemLibrary) Ban(kind string, value string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (l *filesystemLibrary) Unban(id int) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) Allowed(tracks []globals.Track) ([]globals.Track, error) {
+	return tracks, nil
+}
+
+// statistics need the play counters and history of the database
+
+func (l *filesystemLibrary) Stats(top int) (stats.Report, error) {
+	return stats.Report{}, ErrUnsupported
+}
+
+func (l *filesystemLibrary) Health() globals.Health {
+	return globals.Health{Online: true}
+}
+
+// playlists can only be stored in the database
+
+func (l *filesystemLibrary) Playlists() ([]globals.Playlist, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *filesystemLibrary) PlaylistTracks(id int, page globals.Page) ([]globals.Track, int, error) {
+	return nil, 0, ErrUnsupported
+}
+
+func (l *filesystemLibrary) SavePlaylist(name string, tracks []globals.Track) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (l *filesystemLibrary) SaveSmartPlaylist(name string, rules string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (l *filesystemLibrary) SetPlaylistRules(id int, rules string) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) RenamePlaylist(id int, name string) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) DeletePlaylist(id int) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) OverwritePlaylist(id int, tracks []globals.Track) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) AppendToPlaylist(id int, tracks []globals.Track) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) AddPlaylistEntry(id int, trackID int, position int) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) RemovePlaylistEntry(id int, position int) error {
+	return ErrUnsupported
+}
+
+func (l *filesystemLibrary) MovePlaylistEntry(id int, from int, to int) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,247 @@
+// Package library provides a single view on the music library, regardless of
+// whether it is read from the filesystem or from the database. Every frontend
+// (the tui, the webserver and the web interface) should go through Current.
+package library
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/metadata"
+	"github.com/MeesCode/mmjs/search"
+	"github.com/MeesCode/mmjs/stats"
+)
+
+// ErrUnsupported is returned when the library does not support an operation
+// in the current mode, for example playlists in filesystem mode.
+var ErrUnsupported = errors.New("not supported in this mode")
+
+// ErrTrackNotFound is returned for track IDs that are not in the library.
+var ErrTrackNotFound = errors.New("track not found")
+
+// ErrFolderNotFound is returned for folder paths that are not in the library.
+var ErrFolderNotFound = errors.New("folder not found")
+
+// ErrUnknownTag is returned when browsing by something other than an
+// artist, album, genre, year or decade.
+var ErrUnknownTag = database.ErrUnknownTag
+
+// ErrUnknownWindow is returned for popularity windows that are not in stats.Windows.
+var ErrUnknownWindow = errors.New("unknown window, use week, month or all")
+
+// ErrInvalidRating is returned for ratings outside of 0 (unrated) to 5 stars.
+var ErrInvalidRating = errors.New("a rating should be between 0 and 5 stars")
+
+// ErrInvalidTag is returned for tag edits to unknown fields or a year that is not a number.
+var ErrInvalidTag = metadata.ErrInvalidTag
+
+// ErrWriteBack is returned when edited tags could not be written to some of
+// the files, the library itself is changed anyway.
+var ErrWriteBack = errors.New("could not write the tags to every file")
+
+// ErrInvalidBan is returned for bans of something other than a track, artist,
+// genre or folder, or of the root folder.
+var ErrInvalidBan = errors.New("ban an existing track, an artist, a genre or a folder other than the root")
+
+// ErrBanNotFound is returned when a ban that is removed does not exist.
+var ErrBanNotFound = database.ErrBanNotFound
+
+// BanKinds are the kinds of things that can be banned.
+var BanKinds = []string{"track", "artist", "genre", "folder"}
+
+// errors returned by the playlist methods
+var (
+	ErrPlaylistExists   = database.ErrPlaylistExists
+	ErrPlaylistNotFound = database.ErrPlaylistNotFound
+	ErrInvalidPosition  = database.ErrInvalidPosition
+	ErrSmartPlaylist    = database.ErrSmartPlaylist
+	ErrNotSmart         = database.ErrNotSmart
+)
+
+// Library is implemented by every source of tracks.
+type Library interface {
+	// Root returns the top level folder of the library.
+	Root() (globals.Folder, error)
+	// Folder returns the folder with the given path, relative to the root.
+	Folder(rpath string) (globals.Folder, error)
+	// Parent returns the folder that contains the given folder.
+	Parent(folder globals.Folder) (globals.Folder, error)
+	// Folders returns a page of the folders directly inside the given folder,
+	// and the number of folders on all pages.
+	Folders(folder globals.Folder, page globals.Page) ([]globals.Folder, int, error)
+	// Tracks returns a page of the tracks directly inside the given folder, and
+	// the number of tracks on all pages.
+	Tracks(folder globals.Folder, page globals.Page) ([]globals.Track, int, error)
+	// AllTracks returns the tracks inside the given folder and all its children.
+	AllTracks(folder globals.Folder) ([]globals.Track, error)
+	// Groups returns a page of the distinct values of a tag (artist, album,
+	// genre, year or decade) among the tracks in the selection, with the number
+	// of tracks for each, and the number of values on all pages.
+	Groups(tag string, selection []globals.Group, page globals.Page) ([]globals.Group, int, error)
+	// Selection returns a page of the tracks that have every tag value in the
+	// selection, and the number of tracks on all pages.
+	Selection(selection []globals.Group, page globals.Page) ([]globals.Track, int, error)
+	// Track returns the track with the given ID.
+	Track(id int) (globals.Track, error)
+	// Search returns a page of the tracks that match a query, best match first,
+	// and the number of matches on all pages. Malformed queries return a
+	// *search.SyntaxError.
+	Search(query string, page globals.Page) ([]globals.Track, int, error)
+	// Similar returns n tracks that are like the track with the given ID, best first.
+	Similar(id int, n int) ([]globals.Track, error)
+	// Random returns n random tracks, leaving out tracks rated one star.
+	Random(n int) ([]globals.Track, error)
+	// Popular returns the n most played tracks within a window of stats.Windows
+	// (week, month or all), recent plays weigh more than older ones.
+	Popular(window string, n int) ([]globals.Track, error)
+	// IncrementPlays adds one to the play counter of a track.
+	IncrementPlays(id int) error
+	// SetRating gives a track 1 to 5 stars, 0 removes the rating.
+	SetRating(id int, rating int) error
+	// SetFavourite marks a track as favourite or removes the mark.
+	SetFavourite(id int, favourite bool) error
+	// EditTags changes tags of the tracks with the given IDs, the changes map a
+	// field of metadata.Fields to its new value and an empty value removes the
+	// tag. With writeBack the tags are also written to the files. Every change
+	// is kept in an audit log.
+	EditTags(ids []int, changes map[string]string, writeBack bool) error
+	// TagEdits returns the n latest tag edits of a track, or of all tracks for ID 0.
+	TagEdits(id int, n int) ([]globals.TagEdit, error)
+	// Bans returns the ban list of the jukebox.
+	Bans() ([]globals.Ban, error)
+	// Ban puts a track (by ID), artist, genre or folder (by path) on the ban
+	// list and returns the ID of the ban. Banned tracks are left out of search
+	// results, random, popular and similar tracks but can still be browsed.
+	Ban(kind string, value string) (int, error)
+	// Unban removes a ban from the ban list.
+	Unban(id int) error
+	// Allowed returns the tracks that are not banned, in the same order. Every
+	// way to queue tracks from the web goes through it.
+	Allowed(tracks []globals.Track) ([]globals.Track, error)
+	// Stats reports on the library and how it is listened to, with the top n
+	// artists, albums and genres.
+	Stats(top int) (stats.Report, error)
+	// Health tells whether the database can be reached, the filesystem always can.
+	Health() globals.Health
+	// Playlists returns all saved playlists.
+	Playlists() ([]globals.Playlist, error)
+	// PlaylistTracks returns a page of the tracks in a saved playlist, in order,
+	// and the number of tracks on all pages. The rules of smart playlists are
+	// evaluated again on every call.
+	PlaylistTracks(id int, page globals.Page) ([]globals.Track, int, error)
+	// SavePlaylist saves the tracks as a new playlist and returns its ID.
+	SavePlaylist(name string, tracks []globals.Track) (int, error)
+	// SaveSmartPlaylist saves a playlist whose tracks are selected by a search
+	// query such as "genre:metal year:<1990 sort:-plays limit:50" and returns its ID.
+	SaveSmartPlaylist(name string, rules string) (int, error)
+	// SetPlaylistRules changes the search query of a smart playlist.
+	SetPlaylistRules(id int, rules string) error
+	// RenamePlaylist gives a saved playlist a new name.
+	RenamePlaylist(id int, name string) error
+	// DeletePlaylist removes a saved playlist.
+	DeletePlaylist(id int) error
+	// OverwritePlaylist replaces the tracks of a saved playlist.
+	OverwritePlaylist(id int, tracks []globals.Track) error
+	// AppendToPlaylist adds the tracks to the end of a saved playlist.
+	AppendToPlaylist(id int, tracks []globals.Track) error
+	// AddPlaylistEntry inserts a track at a position of a saved playlist,
+	// a negative position adds it to the end.
+	AddPlaylistEntry(id int, trackID int, position int) error
+	// RemovePlaylistEntry removes the track at a position of a saved playlist.
+	RemovePlaylistEntry(id int, position int) error
+	// MovePlaylistEntry moves the track at position from to position to.
+	MovePlaylistEntry(id int, from int, to int) error
+}
+
+// Current is the library that is in use, it is set once on startup.
+var Current Library
+
+// Open sets Current to the library for the given mode.
+func Open(mode string) Library {
+	if mode == "filesystem" {
+		Current = newFilesystem()
+	} else {
+		Current = newDatabase()
+	}
+	return Current
+}
+
+// CheckRules returns a *search.SyntaxError when the rules of a smart playlist
+// are malformed or would never select anything.
+func CheckRules(rules string) error {
+	query, err := search.Parse(rules)
+	if err != nil {
+		return err
+	}
+	if query.IsEmpty() {
+		return &search.SyntaxError{Pos: 0, Msg: "the rules select nothing, use a filter, sort or limit"}
+	}
+	return nil
+}
+
+// IsRoot reports whether the folder is the top level folder of the library.
+func IsRoot(folder globals.Folder) bool {
+	return folder.Path == "/"
+}
+
+// checkBan returns the value of a ban the way it is stored: track IDs as
+// numbers and folders as clean paths from the root.
+func checkBan(kind string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case "track":
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return "", ErrInvalidBan
+		}
+		return strconv.Itoa(id), nil
+	case "artist", "genre":
+		if value == "" {
+			return "", ErrInvalidBan
+		}
+		return value, nil
+	case "folder":
+		value = path.Clean("/" + value)
+		if value == "/" {
+			return "", ErrInvalidBan
+		}
+		return value, nil
+	}
+	return "", ErrInvalidBan
+}
+
+// withoutBanned returns the tracks whose ID is not banned, in the same order.
+func withoutBanned(tracks []globals.Track, banned map[int]bool) []globals.Track {
+	if len(banned) == 0 {
+		return tracks
+	}
+	allowed := make([]globals.Track, 0, len(tracks))
+	for _, track := range tracks {
+		if !banned[track.ID] {
+			allowed = append(allowed, track)
+		}
+	}
+	return allowed
+}
+
+// pageTracks returns a page of a list of tracks and the length of the list
+func pageTracks(tracks []globals.Track, page globals.Page) ([]globals.Track, int) {
+	start, end := page.Bounds(len(tracks))
+	return tracks[start:end], len(tracks)
+}
+
+// pageFolders returns a page of a list of folders and the length of the list
+func pageFolders(folders []globals.Folder, page globals.Page) ([]globals.Folder, int) {
+	start, end := page.Bounds(len(folders))
+	return folders[start:end], len(folders)
+}
+
+// pageGroups returns a page of a list of groups and the length of the list
+func pageGroups(groups []globals.Group, page globals.Page) ([]globals.Group, int) {
+	start, end := page.Bounds(len(groups))
+	return groups[start:end], len(groups)
+}
@@ -0,0 +1,49 @@
+package library
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/search"
+)
+
+// how long the search index of the database is used before it is rebuilt
+const searchIndexAge = 10 * time.Minute
+
+// searchIndex keeps a search engine around until the tracks it was built
+// from are outdated.
+type searchIndex struct {
+	lock    sync.Mutex
+	engine  *search.Engine
+	version int
+	built   time.Time
+}
+
+// get returns the search engine, rebuilding it with the given function if
+// the version changed or the index is too old.
+func (s *searchIndex) get(version int, build func() ([]globals.Track, error)) (*search.Engine, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.engine != nil && s.version == version && time.Since(s.built) < searchIndexAge {
+		return s.engine, nil
+	}
+
+	tracks, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	s.engine = search.NewEngine(tracks)
+	s.version = version
+	s.built = time.Now()
+	return s.engine, nil
+}
+
+// invalidate makes sure the index is rebuilt on the next search
+func (s *searchIndex) invalidate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.engine = nil
+}
@@ -0,0 +1,241 @@
+// Package limits protects the webserver and web interface against clients
+// that make too many requests. A client may make a number of requests per
+// kind of action in a window, clients that keep hitting a limit are banned
+// for a while.
+package limits
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Action is a kind of request that has its own limit
+type Action string
+
+// the actions, each endpoint and web interface command is one of them
+const (
+	Read    Action = "read"    // looking at the queue, the player and the library
+	Search  Action = "search"  // searching and random tracks
+	Add     Action = "add"     // adding tracks to the queue
+	Control Action = "control" // play, pause, skip and seek
+	Edit    Action = "edit"    // reordering and removing queued tracks, ratings
+	Admin   Action = "admin"   // playlists, bans, tags and clearing the queue
+	Login   Action = "login"   // attempts to log in
+)
+
+// the limits of actions that are not in the configuration file
+var defaults = map[Action]globals.Limit{
+	Read:    {Requests: 120, Seconds: 60},
+	Search:  {Requests: 30, Seconds: 60},
+	Add:     {Requests: 10, Seconds: 60},
+	Control: {Requests: 10, Seconds: 60},
+	Edit:    {Requests: 30, Seconds: 60},
+	Admin:   {Requests: 30, Seconds: 60},
+	Login:   {Requests: 5, Seconds: 60},
+}
+
+// without configuration a client is banned for defaultBan after hitting
+// limits defaultStrikes times
+const (
+	defaultStrikes = 20
+	defaultBan     = 10 * time.Minute
+)
+
+// clients that have been idle for this long are forgotten once there are
+// more than maxClients
+const (
+	maxClients = 1000
+	idleTime   = time.Hour
+)
+
+// Error is returned when a client may not make a request, either because it
+// hit the limit of the action or because it is banned.
+type Error struct {
+	Action     Action
+	RetryAfter time.Duration
+	Banned     bool
+}
+
+func (e *Error) Error() string {
+	if e.Banned {
+		return fmt.Sprintf("too many requests, banned for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many %s requests, try again in %s", e.Action, e.RetryAfter.Round(time.Second))
+}
+
+// Client holds the counters of a client, it is identified by its account or
+// its address.
+type Client struct {
+	ID          string
+	Requests    int
+	Refused     int
+	Strikes     int
+	Bans        int
+	BannedUntil time.Time
+	LastSeen    time.Time
+
+	lastRefused time.Time
+	buckets     map[Action]*bucket
+}
+
+// Banned reports whether the client is banned right now
+func (c Client) Banned() bool {
+	return time.Now().Before(c.BannedUntil)
+}
+
+// bucket holds the requests a client may still make, it fills up again at
+// the rate of the limit.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	mutex   sync.Mutex
+	clients = make(map[string]*Client)
+)
+
+// Check validates the limits of the configuration file
+func Check() error {
+	config := globals.Config.Limits
+	for name, limit := range config.Actions {
+		if _, ok := defaults[Action(name)]; !ok {
+			return fmt.Errorf("unknown action %s", name)
+		}
+		if limit.Requests < 1 || limit.Seconds < 1 {
+			return fmt.Errorf("%s: requests and seconds should be at least 1", name)
+		}
+	}
+	if config.Strikes < 0 || config.Ban < 0 {
+		return fmt.Errorf("strikes and ban should be at least 0")
+	}
+	return nil
+}
+
+// limit returns the limit of an action
+func limit(action Action) globals.Limit {
+	if l, ok := globals.Config.Limits.Actions[string(action)]; ok {
+		return l
+	}
+	return defaults[action]
+}
+
+// strikes returns how often a client may hit a limit before it is banned,
+// and for how long
+func strikes() (int, time.Duration) {
+	n, ban := defaultStrikes, defaultBan
+	if globals.Config.Limits.Strikes > 0 {
+		n = globals.Config.Limits.Strikes
+	}
+	if globals.Config.Limits.Ban > 0 {
+		ban = time.Duration(globals.Config.Limits.Ban) * time.Minute
+	}
+	return n, ban
+}
+
+// Allow counts a request of a client and returns an Error when it is over the
+// limit of the action or banned. Without limits everything is allowed.
+func Allow(id string, action Action) error {
+	if !globals.Config.Limits.Enable {
+		return nil
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	now := time.Now()
+	c, ok := clients[id]
+	if !ok {
+		forgetIdle(now)
+		c = &Client{ID: id, buckets: make(map[Action]*bucket)}
+		clients[id] = c
+	}
+	c.Requests++
+	c.LastSeen = now
+
+	if now.Before(c.BannedUntil) {
+		c.Refused++
+		return &Error{action, c.BannedUntil.Sub(now), true}
+	}
+
+	// fill the bucket for the time that passed, at most up to the limit
+	l := limit(action)
+	rate := float64(l.Requests) / float64(l.Seconds)
+	b, ok := c.buckets[action]
+	if !ok {
+		b = &bucket{float64(l.Requests), now}
+		c.buckets[action] = b
+	}
+	b.tokens += now.Sub(b.updated).Seconds() * rate
+	if b.tokens > float64(l.Requests) {
+		b.tokens = float64(l.Requests)
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil
+	}
+
+	// strikes are forgotten when a client behaves for as long as a ban lasts
+	n, ban := strikes()
+	if now.Sub(c.lastRefused) > ban {
+		c.Strikes = 0
+	}
+	c.Refused++
+	c.Strikes++
+	c.lastRefused = now
+	if c.Strikes >= n {
+		c.Strikes = 0
+		c.Bans++
+		c.BannedUntil = now.Add(ban)
+		return &Error{action, ban, true}
+	}
+	return &Error{action, time.Duration((1 - b.tokens) / rate * float64(time.Second)), false}
+}
+
+// forgetIdle removes the clients that have been idle for a while and are not
+// banned, once there are many. The mutex should be held.
+func forgetIdle(now time.Time) {
+	if len(clients) < maxClients {
+		return
+	}
+	for id, c := range clients {
+		if now.Sub(c.LastSeen) > idleTime && now.After(c.BannedUntil) {
+			delete(clients, id)
+		}
+	}
+}
+
+// Clients returns the counters of all clients, the most recently seen first
+func Clients() []Client {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	list := make([]Client, 0, len(clients))
+	for _, c := range clients {
+		client := *c
+		client.buckets = nil
+		list = append(list, client)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	return list
+}
+
+// Pardon lifts the ban of a client and forgets its strikes
+func Pardon(id string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if c, ok := clients[id]; ok {
+		c.BannedUntil = time.Time{}
+		c.Strikes = 0
+		c.buckets = make(map[Action]*bucket)
+	}
+}
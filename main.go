@@ -3,6 +3,9 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -15,16 +18,23 @@ import (
 	"errors"
 
 	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/auth"
 	"github.com/MeesCode/mmjs/database"
 	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/limits"
+	"github.com/MeesCode/mmjs/metadata"
 	"github.com/MeesCode/mmjs/plugins"
+	"github.com/MeesCode/mmjs/stats"
 	"github.com/MeesCode/mmjs/tui"
 )
 
 var (
-	modes      = []string{"filesystem", "database", "index"}
+	modes      = []string{"filesystem", "database", "index", "migrate", "stats", "password"}
+	drivers    = []string{"", "mysql", "sqlite"}
 	help       bool
 	configFile string
+	patterns   string
 )
 
 func init() {
@@ -40,16 +50,23 @@ func init() {
 		defaultWebinterfacePort = 3307
 		defaultDatabasePort     = 8081
 		defaultWebserverPort    = 8080
+		defaultDatabaseDriver   = "mysql"
+		defaultDatabaseFile     = "mmjs.db"
 		defaultDatabaseHost     = "localhost"
 		defaultDatabaseUser     = ""
 		defaultDatabasePassword = ""
 		defaultDatabase         = ""
+		defaultDatabaseMigrate  = false
 		defaultConfig           = ""
 		defaultDisableSound     = false
 		defaultHighlight        = "cb2821"
+		defaultCache            = ".mmjs-cache"
+		defaultPatterns         = "{artist}/{album}/{track} - {title}|{artist} - {title}|/{artist}/{title}"
+		defaultStatsOutput      = ""
+		defaultAutofill         = "off"
 
 		modeUsage               = "specifies what mode to run. [" + strings.Join(modes, ", ") + "]"
-		webserverUsage          = "a boolean to specify whether to run the webserver. (only in database mode)"
+		webserverUsage          = "a boolean to specify whether to run the webserver"
 		webinterfaceUsage       = "a boolean to specify whether to run the web interface"
 		serialUsage             = "a boolean to specify whether listen to serial input, if received skip track"
 		serialPortUsage         = "the serial port to use"
@@ -59,19 +76,30 @@ func init() {
 		webserverPortUsage      = "set the port to be used by the webserver plugin"
 		webinterfacePortUsage   = "set the port to be used by the webinterface plugin"
 		databasePortUsage       = "set the port to be used by the database"
+		databaseDriverUsage     = "the storage driver to use in database and index mode. [mysql, sqlite]"
+		databaseFileUsage       = "the file to store the database in when using the sqlite driver"
 		databaseHostUsage       = "set the host for the database connection"
 		databaseUserUsage       = "set the database user"
 		databasePasswordUsage   = "set the database password"
 		databaseUsage           = "The database to use"
+		databaseMigrateUsage    = "apply pending schema migrations on startup instead of refusing to start"
 		disableSoundUsage       = "disables initialization of the sound card (for server use)"
 		configUsage             = "specify a config file to use (overrides command line arguments)"
 		highlightUsage          = "hex code indicating the highlight color of the text user interface"
+		cacheUsage              = "the file to keep the metadata cache in when in filesystem mode"
+		patternsUsage           = "path patterns separated by | used to infer missing tags, tried in order, e.g. {artist}/{album}/{title}. Patterns starting with / match from the root"
+		autofillUsage           = "how to fill the queue when it runs out. [" + strings.Join(audioplayer.Autofills, ", ") + "]"
+		statsOutputUsage        = "in stats mode, export the statistics as csv to this file instead of printing them (- for stdout)"
 	)
 
 	flag.BoolVar(&help, "help", defaultHelp, helpUsage)
 	flag.StringVar(&configFile, "c", defaultConfig, configUsage)
 	flag.StringVar(&globals.Config.Mode, "m", defaultMode, modeUsage)
 	flag.StringVar(&globals.Config.Highlight, "hl", defaultHighlight, highlightUsage)
+	flag.StringVar(&patterns, "tp", defaultPatterns, patternsUsage)
+	flag.StringVar(&globals.Config.Cache, "cf", defaultCache, cacheUsage)
+	flag.StringVar(&globals.Config.StatsOutput, "so", defaultStatsOutput, statsOutputUsage)
+	flag.StringVar(&globals.Config.Autofill, "af", defaultAutofill, autofillUsage)
 	flag.BoolVar(&globals.Config.Quiet, "q", defaultQuiet, quietUsage)
 	flag.BoolVar(&globals.Config.Logging, "x", defaultLogging, loggingUsage)
 	flag.BoolVar(&globals.Config.Webserver.Enable, "w", defaultWebserver, webserverUsage)
@@ -81,10 +109,13 @@ func init() {
 	flag.BoolVar(&globals.Config.Webinterface.Enable, "i", defaultWebinterface, webinterfaceUsage)
 	flag.IntVar(&globals.Config.Webinterface.Port, "ip", defaultWebinterfacePort, webinterfacePortUsage)
 	flag.IntVar(&globals.Config.Database.Port, "dp", defaultDatabasePort, databasePortUsage)
+	flag.StringVar(&globals.Config.Database.Driver, "dd", defaultDatabaseDriver, databaseDriverUsage)
+	flag.StringVar(&globals.Config.Database.File, "df", defaultDatabaseFile, databaseFileUsage)
 	flag.StringVar(&globals.Config.Database.Host, "h", defaultDatabaseHost, databaseHostUsage)
 	flag.StringVar(&globals.Config.Database.User, "u", defaultDatabaseUser, databaseUserUsage)
 	flag.StringVar(&globals.Config.Database.Password, "p", defaultDatabasePassword, databasePasswordUsage)
 	flag.StringVar(&globals.Config.Database.Database, "d", defaultDatabase, databaseUsage)
+	flag.BoolVar(&globals.Config.Database.Migrate, "dm", defaultDatabaseMigrate, databaseMigrateUsage)
 	flag.BoolVar(&globals.Config.DisableSound, "ds", defaultDisableSound, disableSoundUsage)
 }
 
@@ -107,14 +138,50 @@ func loadConfiguration(file string) globals.ConfigFile {
 // check if mounted path corresponds to loaded database
 // by testing a random track from the database
 func validatePath() error {
-	path := database.GetRandomPath()
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	path, err := database.GetRandomPath(ctx)
+	if err == sql.ErrNoRows {
+		return errors.New("Database is empty, did you forget to run index mode first?")
+	}
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
 		return errors.New("Filesystem not mounted correctly")
-		log.Fatalln("filesystem error", path)
 	}
 	return nil
 }
 
+// printStats prints the statistics, or writes them as csv to a file
+func printStats(output string) error {
+	ctx, cancel := database.Context()
+	defer cancel()
+
+	report, err := stats.Build(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		stats.WriteText(os.Stdout, report)
+		return nil
+	}
+
+	if output == "-" {
+		return stats.WriteCSV(os.Stdout, report)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return stats.WriteCSV(f, report)
+}
+
 func main() {
 
 	// write log to file
@@ -136,6 +203,43 @@ func main() {
 	// load configuration file if one is specified
 	if configFile != "" {
 		globals.Config = loadConfiguration(configFile)
+	} else if patterns != "" {
+		globals.Config.Patterns = strings.Split(patterns, "|")
+	}
+
+	// compile the patterns used to infer missing tags
+	if err := metadata.SetPatterns(globals.Config.Patterns); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// check the accounts and roles of the webserver and web interface
+	if err := auth.Check(); err != nil {
+		fmt.Println("invalid auth settings:", err)
+		return
+	}
+
+	// check the rate limits of the webserver and web interface
+	if err := limits.Check(); err != nil {
+		fmt.Println("invalid limits:", err)
+		return
+	}
+
+	// print a hash of a password to put in the configuration file
+	if globals.Config.Mode == "password" {
+		fmt.Print("password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			fmt.Println("could not read the password:", err)
+			return
+		}
+		hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			fmt.Println("could not hash the password:", err)
+			return
+		}
+		fmt.Println(hash)
+		return
 	}
 
 	base, err := os.Getwd()
@@ -146,8 +250,8 @@ func main() {
 
 	arg := flag.Arg(0)
 
-	// check that a path has been given
-	if arg == "" {
+	// check that a path has been given, migrating and statistics do not need one
+	if arg == "" && globals.Config.Mode != "migrate" && globals.Config.Mode != "stats" {
 		fmt.Println("please specify a path")
 		return
 	}
@@ -166,6 +270,20 @@ func main() {
 		return
 	}
 
+	// check if storage driver is correct
+	if !globals.Contains(drivers, globals.Config.Database.Driver) {
+		fmt.Println("please use one of the available storage drivers")
+		flag.PrintDefaults()
+		return
+	}
+
+	// check if autofill strategy is correct, a config file may leave it out
+	if globals.Config.Autofill != "" && !globals.Contains(audioplayer.Autofills, globals.Config.Autofill) {
+		fmt.Println("please use one of the available autofill strategies")
+		flag.PrintDefaults()
+		return
+	}
+
 	// check if path exists
 	if _, err := os.Stat(globals.Root); os.IsNotExist(err) {
 		fmt.Println("chosen path: " + globals.Root)
@@ -179,23 +297,59 @@ func main() {
 		log.SetOutput(os.Stdout)
 	}
 
+	// sqlite databases are local, so they are always kept up to date.
+	// indexing and migrating may always update the schema as well.
+	if globals.Config.Database.Driver == "sqlite" ||
+		globals.Config.Mode == "index" || globals.Config.Mode == "migrate" {
+		globals.Config.Database.Migrate = true
+	}
+
+	// only apply the pending schema migrations
+	if globals.Config.Mode == "migrate" {
+		db, err := database.Warmup(context.Background())
+		if err != nil {
+			fmt.Println("could not migrate the database:", err)
+			return
+		}
+		db.Close()
+		fmt.Println("database schema is up to date")
+		return
+	}
+
+	// print or export the statistics of the database
+	if globals.Config.Mode == "stats" {
+		db, err := database.Warmup(context.Background())
+		if err != nil {
+			fmt.Println("could not connect to the database:", err)
+			return
+		}
+		defer db.Close()
+
+		if err := printStats(globals.Config.StatsOutput); err != nil {
+			fmt.Println("could not write the statistics:", err)
+		}
+		return
+	}
+
 	// index filesystem at specified path
 	if globals.Config.Mode == "index" {
-		db, err := database.Warmup()
+		db, err := database.Warmup(context.Background())
 
 		if err != nil {
-			log.Fatalln("could not connect to the database")
+			log.Fatalln("could not connect to the database", err)
 			return
 		}
 
 		defer db.Close()
-		database.Index()
+		if err := database.Index(context.Background()); err != nil {
+			fmt.Println("could not index the library:", err)
+		}
 		return
 	}
 
 	// start the database connection pool
 	if globals.Config.Mode != "filesystem" {
-		db, err := database.Warmup()
+		db, err := database.Warmup(context.Background())
 
 		if err != nil {
 			tui.DisplayError(err)
@@ -210,6 +364,20 @@ func main() {
 		}
 
 		defer db.Close()
+
+		// reconnect in the background when the database goes away
+		go database.Monitor()
+	}
+
+	// open the library for the chosen mode
+	library.Open(globals.Config.Mode)
+
+	// in filesystem mode the metadata is cached, bring the cache up to date
+	// in the background and save it when closing
+	if globals.Config.Mode == "filesystem" {
+		metadata.LoadCache(globals.Config.Cache)
+		go metadata.BuildCache()
+		defer metadata.SaveCache()
 	}
 
 	// initialize audio player
@@ -0,0 +1,246 @@
+package metadata
+
+import (
+	"encoding/gob"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// cacheVersion changes whenever the layout of the cache file changes,
+// older caches are then thrown away.
+const cacheVersion = 1
+
+// entry holds the metadata of a single file and the state of the file
+// at the time it was read.
+type entry struct {
+	ModTime int64
+	Size    int64
+	Track   globals.Track
+}
+
+// cacheFile is what is stored on disk
+type cacheFile struct {
+	Version  int
+	Root     string
+	Patterns []string
+	Entries  map[string]entry
+}
+
+// the metadata cache that is used in filesystem mode, keyed by the path
+// relative to the root.
+var cache = struct {
+	sync.RWMutex
+	file    string
+	entries map[string]entry
+	dirty   bool
+	ready   bool
+	changes int
+}{entries: make(map[string]entry)}
+
+// LoadCache reads the metadata cache from the given file. A missing file or
+// a cache that was built for another root or other patterns is ignored.
+func LoadCache(file string) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.file = file
+
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var stored cacheFile
+	err = gob.NewDecoder(f).Decode(&stored)
+	if err != nil {
+		log.Println("could not read metadata cache, starting over", err)
+		return
+	}
+
+	if stored.Version != cacheVersion || stored.Root != globals.Root ||
+		strings.Join(stored.Patterns, "|") != strings.Join(globals.Config.Patterns, "|") {
+		log.Println("metadata cache is outdated, starting over")
+		return
+	}
+
+	cache.entries = stored.Entries
+}
+
+// SaveCache writes the metadata cache to disk, if anything changed.
+func SaveCache() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if !cache.dirty || cache.file == "" {
+		return
+	}
+
+	// write to a temporary file first so a crash never leaves a broken cache
+	f, err := os.Create(cache.file + ".tmp")
+	if err != nil {
+		log.Println("could not save metadata cache", err)
+		return
+	}
+
+	err = gob.NewEncoder(f).Encode(cacheFile{
+		Version:  cacheVersion,
+		Root:     globals.Root,
+		Patterns: globals.Config.Patterns,
+		Entries:  cache.entries,
+	})
+	f.Close()
+	if err != nil {
+		log.Println("could not save metadata cache", err)
+		return
+	}
+
+	err = os.Rename(cache.file+".tmp", cache.file)
+	if err != nil {
+		log.Println("could not save metadata cache", err)
+		return
+	}
+
+	cache.dirty = false
+}
+
+// Lookup returns the metadata of the file at the given path relative to the root.
+// The file is only read when it is not cached yet or changed since it was cached.
+func Lookup(rpath string) globals.Track {
+	file := path.Join(globals.Root, rpath)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return ReadTrack(file)
+	}
+
+	cache.RLock()
+	cached, ok := cache.entries[rpath]
+	cache.RUnlock()
+
+	if ok && cached.ModTime == info.ModTime().UnixNano() && cached.Size == info.Size() {
+		return cached.Track
+	}
+
+	track := ReadTrack(file)
+
+	cache.Lock()
+	cache.entries[rpath] = entry{ModTime: info.ModTime().UnixNano(), Size: info.Size(), Track: track}
+	cache.dirty = true
+	cache.changes++
+	cache.Unlock()
+
+	return track
+}
+
+// CacheReady reports whether the cache has been built and covers the entire library.
+func CacheReady() bool {
+	cache.RLock()
+	defer cache.RUnlock()
+	return cache.ready
+}
+
+// CacheChanges returns a counter that increases whenever the cache changes,
+// so users of Cached know when to refresh.
+func CacheChanges() int {
+	cache.RLock()
+	defer cache.RUnlock()
+	return cache.changes
+}
+
+// Cached returns the metadata of every file in the cache. Changed files are
+// not checked, they are re-read once they are looked up.
+func Cached() []globals.Track {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	tracks := make([]globals.Track, 0, len(cache.entries))
+	for _, cached := range cache.entries {
+		tracks = append(tracks, cached.Track)
+	}
+	return tracks
+}
+
+// BuildCache walks the entire library and brings the cache up to date,
+// after which the cache is saved periodically. It is meant to be run as a goroutine.
+func BuildCache() {
+	start := time.Now()
+
+	if err := updateCache(); err != nil {
+		log.Println("Could not walk the filesystem to build the metadata cache", err)
+		return
+	}
+
+	log.Println("metadata cache built in", time.Since(start))
+
+	for {
+		SaveCache()
+		time.Sleep(time.Minute)
+	}
+}
+
+// updateCache looks up every file in the library and forgets the files that
+// no longer exist, after which the cache is ready. Folders that can not be
+// read are skipped, only when the root can not be read the cache is not ready.
+func updateCache() error {
+	seen := make(map[string]bool)
+
+	err := filepath.Walk(globals.Root, cacheWalker(seen))
+	if err != nil {
+		return err
+	}
+
+	// forget files that no longer exist
+	cache.Lock()
+	for rpath := range cache.entries {
+		if !seen[rpath] {
+			delete(cache.entries, rpath)
+			cache.dirty = true
+			cache.changes++
+		}
+	}
+	cache.ready = true
+	cache.Unlock()
+
+	return nil
+}
+
+// cacheWalker returns the function that looks up every supported file while
+// walking the library, the files are marked as seen.
+func cacheWalker(seen map[string]bool) filepath.WalkFunc {
+	return func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if file == globals.Root {
+				return err
+			}
+			log.Println("skipping", file, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// skip hidden folders and files
+		if strings.HasPrefix(info.Name(), ".") && file != globals.Root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.IsDir() && globals.Contains(globals.GetSupportedFormats(), strings.ToLower(path.Ext(file))) {
+			rpath := path.Clean(file[len(globals.Root):])
+			seen[rpath] = true
+			Lookup(rpath)
+		}
+
+		return nil
+	}
+}
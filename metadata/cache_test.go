@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+func TestCacheSkipsUnreadableFolders(t *testing.T) {
+	globals.Root = t.TempDir()
+	for _, dir := range []string{"Readable", "Unreadable"} {
+		if err := os.Mkdir(filepath.Join(globals.Root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(globals.Root, dir, "Song.mp3"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(globals.Root, "Unreadable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied := errors.New("permission denied")
+	walk := cacheWalker(make(map[string]bool))
+	if err := walk(filepath.Join(globals.Root, "Unreadable"), info, denied); err != filepath.SkipDir {
+		t.Errorf("an unreadable folder gave %v, want SkipDir", err)
+	}
+	if err := walk(filepath.Join(globals.Root, "Unreadable", "Song.mp3"), nil, denied); err != nil {
+		t.Errorf("an unreadable file gave %v, want it skipped", err)
+	}
+	if err := walk(globals.Root, info, denied); err != denied {
+		t.Errorf("an unreadable root gave %v, want %v", err, denied)
+	}
+
+	// files that are gone are forgotten and the cache becomes ready
+	cache.entries = map[string]entry{"/Gone.mp3": {}}
+	defer func() { cache.entries, cache.ready = make(map[string]entry), false }()
+	if err := updateCache(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries["/Gone.mp3"]; ok || len(cache.entries) != 2 || !CacheReady() {
+		t.Errorf("cache has %v (ready %v), want the 2 songs", cache.entries, cache.ready)
+	}
+}
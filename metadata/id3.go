@@ -0,0 +1,172 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// room left after a rewritten tag, so small edits later on fit
+const id3Padding = 1024
+
+// id3Frame returns the text frame a field is stored in, which for the year
+// differs between id3v2.3 and id3v2.4.
+func id3Frame(field string, version byte) string {
+	switch field {
+	case "title":
+		return "TIT2"
+	case "artist":
+		return "TPE1"
+	case "album":
+		return "TALB"
+	case "genre":
+		return "TCON"
+	}
+	if version == 4 {
+		return "TDRC"
+	}
+	return "TYER"
+}
+
+// writeID3 replaces the text frames of the changed fields in the id3v2 tag at
+// the start of an mp3 file, other frames are copied as they are. Files without
+// a tag get an id3v2.3 tag.
+func writeID3(data []byte, changes map[string]string) ([]byte, error) {
+	version := byte(3)
+	var frames [][]byte
+	audio := data
+
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		version = data[3]
+		flags := data[5]
+		size := synchsafe(data[6:10])
+
+		if version < 3 || version > 4 {
+			return nil, errors.New("only id3v2.3 and id3v2.4 tags can be written")
+		}
+		// unsynchronisation and extended headers are rare enough to not bother
+		if flags&0xc0 != 0 {
+			return nil, errors.New("id3 tags with unsynchronisation or an extended header can not be written")
+		}
+
+		end := 10 + size
+		if flags&0x10 != 0 {
+			end += 10 // footer
+		}
+		if end > len(data) {
+			return nil, errors.New("id3 tag is truncated")
+		}
+
+		var err error
+		frames, err = id3Frames(data[10:10+size], version)
+		if err != nil {
+			return nil, err
+		}
+		audio = data[end:]
+	}
+
+	// the year can be in either frame, depending on what wrote the tag
+	replaced := make(map[string]bool)
+	for field := range changes {
+		replaced[id3Frame(field, version)] = true
+		if field == "year" {
+			replaced["TYER"], replaced["TDRC"] = true, true
+		}
+	}
+
+	var body bytes.Buffer
+	for _, frame := range frames {
+		if !replaced[string(frame[:4])] {
+			body.Write(frame)
+		}
+	}
+	for _, field := range Fields {
+		if value := changes[field]; value != "" {
+			body.Write(id3TextFrame(id3Frame(field, version), value, version))
+		}
+	}
+	body.Write(make([]byte, id3Padding))
+
+	out := make([]byte, 0, 10+body.Len()+len(audio))
+	out = append(out, 'I', 'D', '3', version, 0, 0)
+	out = append(out, synchsafeBytes(body.Len())...)
+	out = append(out, body.Bytes()...)
+	return append(out, audio...), nil
+}
+
+// id3Frames splits the body of a tag into its frames, including their headers.
+func id3Frames(body []byte, version byte) ([][]byte, error) {
+	frames := make([][]byte, 0)
+
+	for pos := 0; pos+10 <= len(body); {
+		// the rest is padding
+		if body[pos] == 0 {
+			break
+		}
+
+		var size int
+		if version == 4 {
+			size = synchsafe(body[pos+4 : pos+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+
+		end := pos + 10 + size
+		if size < 0 || end > len(body) {
+			return nil, errors.New("id3 frame is truncated")
+		}
+		frames = append(frames, body[pos:end])
+		pos = end
+	}
+
+	return frames, nil
+}
+
+// id3TextFrame encodes a text frame. Id3v2.4 uses utf-8, id3v2.3 only knows
+// latin-1 and utf-16 so utf-16 is used whenever latin-1 is not enough.
+func id3TextFrame(id string, value string, version byte) []byte {
+	var text []byte
+	switch {
+	case version == 4:
+		text = append([]byte{3}, value...)
+	case isLatin1(value):
+		text = []byte{0}
+		for _, r := range value {
+			text = append(text, byte(r))
+		}
+	default:
+		text = []byte{1, 0xff, 0xfe}
+		for _, unit := range utf16.Encode([]rune(value)) {
+			text = append(text, byte(unit), byte(unit>>8))
+		}
+	}
+
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	if version == 4 {
+		copy(frame[4:8], synchsafeBytes(len(text)))
+	} else {
+		binary.BigEndian.PutUint32(frame[4:8], uint32(len(text)))
+	}
+	return append(frame, text...)
+}
+
+// isLatin1 reports whether every character of the string fits in latin-1
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// synchsafe decodes a 28 bit integer stored in 4 bytes of 7 bits
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// synchsafeBytes encodes a 28 bit integer in 4 bytes of 7 bits
+func synchsafeBytes(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// pattern is a compiled path pattern such as {artist}/{album}/{track} - {title}
+type pattern struct {
+	source string
+	regex  *regexp.Regexp
+	fields []string
+}
+
+// the placeholders that can be used in a pattern and what they match.
+// {track} and {*} only have to match, their value is not stored.
+var placeholders = map[string]string{
+	"artist": `([^/]+?)`,
+	"album":  `([^/]+?)`,
+	"title":  `([^/]+?)`,
+	"genre":  `([^/]+?)`,
+	"year":   `(\d{4})`,
+	"track":  `(\d+)`,
+	"*":      `([^/]*?)`,
+}
+
+var patterns []pattern
+
+// SetPatterns compiles the path patterns that are used to infer missing tags.
+// Patterns are tried in order and the first one that matches the end of the
+// path (without extension) is used. A pattern that starts with / has to match
+// the whole path from the root, so /{artist}/{title} does not take the album
+// folder of Artist/Album/Title.mp3 for the artist.
+func SetPatterns(sources []string) error {
+	compiled := make([]pattern, 0, len(sources))
+
+	for _, source := range sources {
+		p, err := compile(source)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, p)
+	}
+
+	patterns = compiled
+	return nil
+}
+
+// compile turns a single pattern into a regular expression
+func compile(source string) (pattern, error) {
+	var expr strings.Builder
+	var fields []string
+	rest := strings.TrimPrefix(source, "/")
+
+	for rest != "" {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+
+		end := strings.Index(rest[open:], "}")
+		if end < 0 {
+			return pattern{}, errors.New("unclosed placeholder in pattern " + source)
+		}
+
+		name := rest[open+1 : open+end]
+		sub, ok := placeholders[name]
+		if !ok {
+			return pattern{}, errors.New("unknown placeholder {" + name + "} in pattern " + source)
+		}
+
+		expr.WriteString(regexp.QuoteMeta(rest[:open]))
+		expr.WriteString(sub)
+		fields = append(fields, name)
+		rest = rest[open+end+1:]
+	}
+
+	start := `(?:^|/)`
+	if strings.HasPrefix(source, "/") {
+		start = `^`
+	}
+	regex, err := regexp.Compile(start + expr.String() + `$`)
+	if err != nil {
+		return pattern{}, err
+	}
+
+	return pattern{source: source, regex: regex, fields: fields}, nil
+}
+
+// Infer fills in the missing fields of a track from its path using the first
+// pattern that matches. Every field that is filled in is added to the
+// comma separated Inferred list of the track.
+func Infer(track *globals.Track) {
+	rpath := strings.TrimPrefix(track.Path, "/")
+	rpath = strings.TrimSuffix(rpath, path.Ext(rpath))
+
+	for _, p := range patterns {
+		match := p.regex.FindStringSubmatch(rpath)
+		if match == nil {
+			continue
+		}
+
+		var inferred []string
+		for i, field := range p.fields {
+			value := strings.TrimSpace(match[i+1])
+			if value == "" {
+				continue
+			}
+
+			switch field {
+			case "artist":
+				if !track.Artist.Valid {
+					track.Artist = nullString(value)
+					inferred = append(inferred, field)
+				}
+			case "album":
+				if !track.Album.Valid {
+					track.Album = nullString(value)
+					inferred = append(inferred, field)
+				}
+			case "title":
+				if !track.Title.Valid {
+					track.Title = nullString(value)
+					inferred = append(inferred, field)
+				}
+			case "genre":
+				if !track.Genre.Valid {
+					track.Genre = nullString(value)
+					inferred = append(inferred, field)
+				}
+			case "year":
+				year, err := strconv.Atoi(value)
+				if !track.Year.Valid && err == nil {
+					track.Year = nullInt(year)
+					inferred = append(inferred, field)
+				}
+			}
+		}
+
+		track.Inferred = nullString(strings.Join(inferred, ","))
+		return
+	}
+}
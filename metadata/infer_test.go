@@ -0,0 +1,46 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+func TestInferDefaultPatterns(t *testing.T) {
+	if err := SetPatterns([]string{"{artist}/{album}/{track} - {title}", "{artist} - {title}", "/{artist}/{title}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, artist, album, title string
+	}{
+		{"/Artist/Album/01 - Song.mp3", "Artist", "Album", "Song"},
+		{"/Rock/Artist/Album/01 - Song.mp3", "Artist", "Album", "Song"},
+		{"/Artist/Song.mp3", "Artist", "", "Song"},
+		{"/Various/Artist - Song.mp3", "Artist", "", "Song"},
+		// the album folder is not the artist
+		{"/Artist/Album/Song.mp3", "", "", ""},
+	}
+
+	for _, test := range tests {
+		track := globals.Track{Path: test.path}
+		Infer(&track)
+		if track.Artist.String != test.artist || track.Album.String != test.album || track.Title.String != test.title {
+			t.Errorf("Infer(%s) = %q/%q/%q, want %q/%q/%q", test.path,
+				track.Artist.String, track.Album.String, track.Title.String,
+				test.artist, test.album, test.title)
+		}
+	}
+}
+
+func TestInferKeepsTheOrderOfPatterns(t *testing.T) {
+	if err := SetPatterns([]string{"{artist}/{title}", "{artist}/{album}/{title}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	track := globals.Track{Path: "/Artist/Album/Song.mp3"}
+	Infer(&track)
+	if track.Artist.String != "Album" || track.Album.Valid {
+		t.Errorf("the first pattern was not used, got %q/%q", track.Artist.String, track.Album.String)
+	}
+}
@@ -0,0 +1,50 @@
+// Package metadata reads the tags of playable files and fills in whatever is
+// missing from them.
+package metadata
+
+import (
+	"database/sql"
+	"os"
+	"path"
+
+	"github.com/MeesCode/mmjs/globals"
+
+	"github.com/dhowden/tag"
+)
+
+// ReadTrack takes an absolute path to a playable file, extracts the metadata and
+// returns a track containing it. Fields that are not tagged are inferred from
+// the path where possible, otherwise they are left as nil.
+func ReadTrack(file string) globals.Track {
+	track := globals.Track{
+		ID:       -1,
+		Path:     path.Clean(file[len(globals.Root):]),
+		FolderID: -1,
+	}
+
+	f, err := os.Open(file)
+	if err == nil {
+		defer f.Close()
+		m, err := tag.ReadFrom(f)
+		if err == nil {
+			track.Title = nullString(m.Title())
+			track.Artist = nullString(m.Artist())
+			track.Album = nullString(m.Album())
+			track.Genre = nullString(m.Genre())
+			track.Year = nullInt(m.Year())
+		}
+	}
+
+	Infer(&track)
+	return track
+}
+
+// nullString converts a string into a nullable string.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt converts an int into a nullable int.
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// oggPage is a single page of an ogg stream
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	segments []byte
+	data     []byte
+}
+
+// readOggPage reads the page that starts at pos and returns it with the
+// position of the next page.
+func readOggPage(data []byte, pos int) (oggPage, int, error) {
+	if pos+27 > len(data) || string(data[pos:pos+4]) != "OggS" {
+		return oggPage{}, 0, errors.New("not an ogg page")
+	}
+
+	count := int(data[pos+26])
+	start := pos + 27 + count
+	if start > len(data) {
+		return oggPage{}, 0, errors.New("ogg page is truncated")
+	}
+
+	page := oggPage{
+		flags:    data[pos+5],
+		granule:  binary.LittleEndian.Uint64(data[pos+6:]),
+		serial:   binary.LittleEndian.Uint32(data[pos+14:]),
+		sequence: binary.LittleEndian.Uint32(data[pos+18:]),
+		segments: data[pos+27 : start],
+	}
+
+	size := 0
+	for _, segment := range page.segments {
+		size += int(segment)
+	}
+	if start+size > len(data) {
+		return oggPage{}, 0, errors.New("ogg page is truncated")
+	}
+	page.data = data[start : start+size]
+
+	return page, start + size, nil
+}
+
+// bytes encodes the page with a new checksum
+func (page oggPage) bytes() []byte {
+	out := make([]byte, 27, 27+len(page.segments)+len(page.data))
+	copy(out, "OggS")
+	out[5] = page.flags
+	binary.LittleEndian.PutUint64(out[6:], page.granule)
+	binary.LittleEndian.PutUint32(out[14:], page.serial)
+	binary.LittleEndian.PutUint32(out[18:], page.sequence)
+	out[26] = byte(len(page.segments))
+	out = append(out, page.segments...)
+	out = append(out, page.data...)
+
+	binary.LittleEndian.PutUint32(out[22:], oggChecksum(out))
+	return out
+}
+
+// writeOgg replaces the comment header of an ogg vorbis file. A vorbis stream
+// starts with three header packets: identification, comments and setup. The
+// last two are paginated again, after which the sequence numbers of the
+// audio pages are corrected when the number of header pages changed.
+func writeOgg(data []byte, changes map[string]string) ([]byte, error) {
+	packets := make([][]byte, 0, 3)
+	var packet []byte
+	var first oggPage
+	var serial uint32
+	pages, pos := 0, 0
+
+	for len(packets) < 3 {
+		page, next, err := readOggPage(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		if pages == 0 {
+			first, serial = page, page.serial
+		} else if page.serial != serial {
+			return nil, errors.New("ogg files with more than one stream can not be written")
+		}
+
+		offset := 0
+		for _, segment := range page.segments {
+			packet = append(packet, page.data[offset:offset+int(segment)]...)
+			offset += int(segment)
+			if segment < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		// the identification header has a page of its own
+		if pages == 0 && len(packets) != 1 {
+			return nil, errors.New("unexpected layout of the vorbis headers")
+		}
+
+		pages++
+		pos = next
+	}
+
+	// the audio starts on a fresh page, so the headers end with a page
+	if len(packets) != 3 || packet != nil {
+		return nil, errors.New("unexpected layout of the vorbis headers")
+	}
+	if len(packets[1]) < 7 || string(packets[1][:7]) != "\x03vorbis" {
+		return nil, errors.New("not an ogg vorbis file")
+	}
+
+	// the framing bit at the end of the comment packet is left out while
+	// reading the comments and added again afterwards
+	comments, err := updateComments(packets[1][7:], changes)
+	if err != nil {
+		return nil, err
+	}
+	packets[1] = append(append([]byte("\x03vorbis"), comments...), 1)
+
+	out := make([]byte, 0, len(data)+len(comments))
+	out = append(out, first.bytes()...)
+
+	headers := oggPaginate(packets[1:], serial, 1)
+	for _, page := range headers {
+		out = append(out, page.bytes()...)
+	}
+
+	shift := uint32(len(headers) + 1 - pages)
+	if shift == 0 {
+		return append(out, data[pos:]...), nil
+	}
+
+	for pos < len(data) {
+		page, next, err := readOggPage(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		if page.serial == serial {
+			page.sequence += shift
+		}
+		out = append(out, page.bytes()...)
+		pos = next
+	}
+
+	return out, nil
+}
+
+// oggPaginate lays out the packets over as many pages as needed, numbered
+// from sequence on. Pages on which no packet ends have no granule position.
+func oggPaginate(packets [][]byte, serial uint32, sequence uint32) []oggPage {
+	type segment struct {
+		data []byte
+		last bool
+	}
+
+	segments := make([]segment, 0)
+	for _, packet := range packets {
+		for len(packet) >= 255 {
+			segments = append(segments, segment{data: packet[:255]})
+			packet = packet[255:]
+		}
+		segments = append(segments, segment{data: packet, last: true})
+	}
+
+	pages := make([]oggPage, 0)
+	continued := false
+	for len(segments) > 0 {
+		n := len(segments)
+		if n > 255 {
+			n = 255
+		}
+
+		page := oggPage{serial: serial, sequence: sequence, granule: ^uint64(0)}
+		if continued {
+			page.flags = 1
+		}
+		for _, s := range segments[:n] {
+			page.segments = append(page.segments, byte(len(s.data)))
+			page.data = append(page.data, s.data...)
+			if s.last {
+				page.granule = 0
+			}
+		}
+
+		continued = !segments[n-1].last
+		segments = segments[n:]
+		pages = append(pages, page)
+		sequence++
+	}
+
+	return pages
+}
+
+// the crc of ogg pages, which is not the one of hash/crc32 because it
+// shifts to the left
+var oggTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggChecksum calculates the crc of a page whose checksum field is zero
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggTable[byte(crc>>24)^b]
+	}
+	return crc
+}
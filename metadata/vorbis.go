@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// the vorbis comment each field is stored in, flac and ogg both use them
+var vorbisKeys = map[string]string{
+	"title":  "TITLE",
+	"artist": "ARTIST",
+	"album":  "ALBUM",
+	"genre":  "GENRE",
+	"year":   "DATE",
+}
+
+// room left in a padding block after the comments, so small edits later on fit
+const flacPadding = 1024
+
+// updateComments applies the changes to a vorbis comment block. The vendor and
+// the comments that are not changed are kept, an empty block starts a new one.
+func updateComments(block []byte, changes map[string]string) ([]byte, error) {
+	vendor := "mmjs"
+	comments := make([]string, 0)
+
+	if len(block) > 0 {
+		r := bytes.NewReader(block)
+
+		var err error
+		vendor, err = readVorbisString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, errors.New("vorbis comments are truncated")
+		}
+		for i := uint32(0); i < count; i++ {
+			comment, err := readVorbisString(r)
+			if err != nil {
+				return nil, err
+			}
+			comments = append(comments, comment)
+		}
+	}
+
+	replaced := make(map[string]bool)
+	for field := range changes {
+		replaced[vorbisKeys[field]] = true
+	}
+
+	kept := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		key := strings.ToUpper(strings.SplitN(comment, "=", 2)[0])
+		if !replaced[key] {
+			kept = append(kept, comment)
+		}
+	}
+	for _, field := range Fields {
+		if value := changes[field]; value != "" {
+			kept = append(kept, vorbisKeys[field]+"="+value)
+		}
+	}
+
+	var out bytes.Buffer
+	writeVorbisString(&out, vendor)
+	binary.Write(&out, binary.LittleEndian, uint32(len(kept)))
+	for _, comment := range kept {
+		writeVorbisString(&out, comment)
+	}
+	return out.Bytes(), nil
+}
+
+// readVorbisString reads a string prefixed with its length
+func readVorbisString(r *bytes.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil || int64(length) > int64(r.Len()) {
+		return "", errors.New("vorbis comments are truncated")
+	}
+	s := make([]byte, length)
+	r.Read(s)
+	return string(s), nil
+}
+
+// writeVorbisString writes a string prefixed with its length
+func writeVorbisString(w *bytes.Buffer, s string) {
+	binary.Write(w, binary.LittleEndian, uint32(len(s)))
+	w.WriteString(s)
+}
+
+// writeFLAC replaces the vorbis comment block of a flac file. Padding blocks
+// are merged into a single one at the end of the metadata, the audio frames
+// are copied as they are.
+func writeFLAC(data []byte, changes map[string]string) ([]byte, error) {
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return nil, errors.New("not a flac file")
+	}
+
+	blocks := make([][]byte, 0)
+	var comments []byte
+	pos := 4
+
+	for {
+		if pos+4 > len(data) {
+			return nil, errors.New("flac metadata is truncated")
+		}
+		header := data[pos]
+		end := pos + 4 + (int(data[pos+1])<<16 | int(data[pos+2])<<8 | int(data[pos+3]))
+		if end > len(data) {
+			return nil, errors.New("flac metadata is truncated")
+		}
+
+		switch header & 0x7f {
+		case 1: // padding
+		case 4: // vorbis comment
+			comments = data[pos+4 : end]
+		default:
+			blocks = append(blocks, data[pos:end])
+		}
+
+		pos = end
+		if header&0x80 != 0 {
+			break
+		}
+	}
+
+	comments, err := updateComments(comments, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data)+flacPadding)
+	out = append(out, "fLaC"...)
+	for _, block := range blocks {
+		out = append(out, block[0]&0x7f)
+		out = append(out, block[1:]...)
+	}
+	out = append(out, flacBlockHeader(4, len(comments), false)...)
+	out = append(out, comments...)
+	out = append(out, flacBlockHeader(1, flacPadding, true)...)
+	out = append(out, make([]byte, flacPadding)...)
+	return append(out, data[pos:]...), nil
+}
+
+// flacBlockHeader encodes the type, length and whether it is the last metadata block
+func flacBlockHeader(kind byte, length int, last bool) []byte {
+	if last {
+		kind |= 0x80
+	}
+	return []byte{kind, byte(length >> 16), byte(length >> 8), byte(length)}
+}
@@ -0,0 +1,84 @@
+package metadata
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Fields are the tags that can be edited, in the order they are shown.
+var Fields = []string{"title", "artist", "album", "genre", "year"}
+
+// ErrUnsupportedFormat is returned when tags can not be written to a file of this type
+var ErrUnsupportedFormat = errors.New("writing tags is not supported for this format")
+
+// ErrInvalidTag is returned for changes to unknown fields or a year that is not a number
+var ErrInvalidTag = errors.New("unknown tag or a year that is not a number")
+
+// CheckChanges returns ErrInvalidTag when a change is not to one of Fields, or
+// when the year is not empty and not a number.
+func CheckChanges(changes map[string]string) error {
+	for field, value := range changes {
+		if !globals.Contains(Fields, field) {
+			return ErrInvalidTag
+		}
+		if field == "year" && value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				return ErrInvalidTag
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTags writes the changed tags to the file at the given absolute path,
+// other tags in the file are kept. The changes map a field of Fields to its new
+// value, an empty value removes the tag. ID3v2 (mp3), FLAC and Ogg Vorbis are
+// supported. The file is replaced only once the new version is completely written.
+func WriteTags(file string, changes map[string]string) error {
+	if err := CheckChanges(changes); err != nil {
+		return err
+	}
+
+	var write func(data []byte, changes map[string]string) ([]byte, error)
+	switch strings.ToLower(path.Ext(file)) {
+	case ".mp3":
+		write = writeID3
+	case ".flac":
+		write = writeFLAC
+	case ".ogg":
+		write = writeOgg
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	data, err = write(data, changes)
+	if err != nil {
+		return err
+	}
+
+	// write next to the original so the rename never crosses filesystems
+	tmp := path.Join(path.Dir(file), ".mmjs-"+path.Base(file)+".tmp")
+	err = ioutil.WriteFile(tmp, data, info.Mode())
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,275 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/dhowden/tag"
+)
+
+// audio stands in for the audio of a file, it has to come out unchanged
+var audio = append([]byte{0xff, 0xfb, 0x90, 0x64}, bytes.Repeat([]byte("ID3 fLaC OggS \x00\xff"), 64)...)
+
+// readTags reads the tags of a file with the same reader ReadTrack uses
+func readTags(t *testing.T, data []byte) tag.Metadata {
+	t.Helper()
+	m, err := tag.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("written file can not be read: %s", err)
+	}
+	return m
+}
+
+// id3v23 returns an mp3 with an id3v2.3 tag with an utf-16 title, a frame
+// that is not changed and some padding
+func id3v23() []byte {
+	text := []byte{1, 0xff, 0xfe}
+	for _, unit := range utf16.Encode([]rune("Ace of Spädes")) {
+		text = append(text, byte(unit), byte(unit>>8))
+	}
+	title := append([]byte("TIT2\x00\x00\x00\x00\x00\x00"), text...)
+	binary.BigEndian.PutUint32(title[4:8], uint32(len(text)))
+	comment := append([]byte("TCOM\x00\x00\x00\x05\x00\x00"), "\x00Lem"...)
+	comment = append(comment, 0)
+
+	body := append(append(title, comment...), make([]byte, 100)...)
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0}, synchsafeBytes(len(body))...)
+	return append(append(tag, body...), audio...)
+}
+
+// id3v24 returns an mp3 with an id3v2.4 tag that ends with a footer
+func id3v24() []byte {
+	frame := func(id, value string) []byte {
+		f := append([]byte(id), synchsafeBytes(len(value)+1)...)
+		return append(append(f, 0, 0, 3), value...)
+	}
+	body := append(frame("TIT2", "Overkill"), frame("TDRC", "1979")...)
+	header := append([]byte{'I', 'D', '3', 4, 0, 0x10}, synchsafeBytes(len(body))...)
+	footer := append([]byte{'3', 'D', 'I', 4, 0, 0x10}, synchsafeBytes(len(body))...)
+	return append(append(append(header, body...), footer...), audio...)
+}
+
+func TestWriteID3(t *testing.T) {
+	for name, test := range map[string]struct {
+		data    []byte
+		changes map[string]string
+		title   string
+		artist  string
+		year    int
+	}{
+		"v2.3 latin-1": {id3v23(), map[string]string{"artist": "Motörhead"}, "Ace of Spädes", "Motörhead", 0},
+		"v2.3 utf-16":  {id3v23(), map[string]string{"artist": "Моторхед", "year": "1980"}, "Ace of Spädes", "Моторхед", 1980},
+		"v2.3 removed": {id3v23(), map[string]string{"title": ""}, "", "", 0},
+		"v2.4 footer":  {id3v24(), map[string]string{"artist": "Motörhead", "year": "1980"}, "Overkill", "Motörhead", 1980},
+		"no tag":       {audio, map[string]string{"title": "Bomber"}, "Bomber", "", 0},
+	} {
+		out, err := writeID3(test.data, test.changes)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		m := readTags(t, out)
+		if m.Title() != test.title || m.Artist() != test.artist || m.Year() != test.year {
+			t.Errorf("%s: read %q/%q/%d, want %q/%q/%d", name, m.Title(), m.Artist(), m.Year(), test.title, test.artist, test.year)
+		}
+		if m.Composer() != "" && m.Composer() != "Lem" {
+			t.Errorf("%s: the unchanged frame became %q", name, m.Composer())
+		}
+
+		// the audio follows the tag directly, also where a footer was
+		if size := 10 + synchsafe(out[6:10]); !bytes.Equal(out[size:], audio) {
+			t.Errorf("%s: the audio after the tag changed", name)
+		}
+	}
+}
+
+// flacFile returns a flac file with a streaminfo, padding and comment block
+func flacFile() []byte {
+	comments, _ := updateComments(nil, map[string]string{"title": "Iron Fist", "artist": "Motörhead"})
+
+	out := []byte("fLaC")
+	out = append(out, flacBlockHeader(0, 34, false)...)
+	out = append(out, make([]byte, 34)...)
+	out = append(out, flacBlockHeader(1, 10, false)...)
+	out = append(out, make([]byte, 10)...)
+	out = append(out, flacBlockHeader(4, len(comments), true)...)
+	out = append(out, comments...)
+	return append(out, audio...)
+}
+
+func TestWriteFLAC(t *testing.T) {
+	out, err := writeFLAC(flacFile(), map[string]string{"album": "Iron Fist", "artist": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := readTags(t, out)
+	if m.Title() != "Iron Fist" || m.Album() != "Iron Fist" || m.Artist() != "" {
+		t.Errorf("read %q/%q/%q, want Iron Fist/Iron Fist/nothing", m.Title(), m.Album(), m.Artist())
+	}
+
+	// walk the blocks: streaminfo first, one padding block last, then the audio
+	var kinds []byte
+	pos := 4
+	for {
+		header := out[pos]
+		kinds = append(kinds, header&0x7f)
+		pos += 4 + (int(out[pos+1])<<16 | int(out[pos+2])<<8 | int(out[pos+3]))
+		if header&0x80 != 0 {
+			break
+		}
+	}
+	if !bytes.Equal(kinds, []byte{0, 4, 1}) {
+		t.Errorf("blocks are %v, want streaminfo, comments and padding", kinds)
+	}
+	if !bytes.Equal(out[pos:], audio) {
+		t.Error("the audio after the metadata changed")
+	}
+
+	// writing again only changes what fits in the padding
+	again, err := writeFLAC(out, map[string]string{"genre": "Metal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := readTags(t, again); m.Genre() != "Metal" || m.Album() != "Iron Fist" {
+		t.Errorf("second write read %q/%q", m.Genre(), m.Album())
+	}
+}
+
+// oggFile returns an ogg vorbis file whose headers take the given title, and
+// a few audio pages
+func oggFile(title string) []byte {
+	identification := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	comments, _ := updateComments(nil, map[string]string{"title": title})
+	comment := append(append([]byte("\x03vorbis"), comments...), 1)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{0x42}, 300)...)
+
+	var out []byte
+	first := oggPaginate([][]byte{identification}, 7, 0)[0]
+	first.flags = 2
+	out = append(out, first.bytes()...)
+
+	headers := oggPaginate([][]byte{comment, setup}, 7, 1)
+	for _, page := range headers {
+		out = append(out, page.bytes()...)
+	}
+
+	sequence := uint32(len(headers) + 1)
+	for i := 0; i < 3; i++ {
+		page := oggPaginate([][]byte{audio}, 7, sequence)[0]
+		page.granule = uint64(1000 * (i + 1))
+		if i == 2 {
+			page.flags = 4
+		}
+		out = append(out, page.bytes()...)
+		sequence++
+	}
+	return out
+}
+
+// checkOggPages checks the crc of every page, that the pages are numbered
+// without gaps and that the audio pages are unchanged
+func checkOggPages(t *testing.T, name string, data []byte) {
+	t.Helper()
+	var sequence uint32
+	var payloads [][]byte
+	for pos := 0; pos < len(data); {
+		page, next, err := readOggPage(data, pos)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		// a plain bitwise crc, so the table is checked too
+		raw := append([]byte{}, data[pos:next]...)
+		stored := binary.LittleEndian.Uint32(raw[22:])
+		copy(raw[22:26], []byte{0, 0, 0, 0})
+		var crc uint32
+		for _, b := range raw {
+			crc ^= uint32(b) << 24
+			for i := 0; i < 8; i++ {
+				if crc&0x80000000 != 0 {
+					crc = crc<<1 ^ 0x04c11db7
+				} else {
+					crc <<= 1
+				}
+			}
+		}
+		if crc != stored {
+			t.Errorf("%s: page %d has crc %x, want %x", name, page.sequence, stored, crc)
+		}
+
+		if page.sequence != sequence {
+			t.Errorf("%s: page %d has sequence number %d", name, sequence, page.sequence)
+		}
+		if page.granule != ^uint64(0) && page.granule >= 1000 {
+			payloads = append(payloads, page.data)
+		}
+		sequence++
+		pos = next
+	}
+
+	if len(payloads) != 3 {
+		t.Fatalf("%s: found %d audio pages, want 3", name, len(payloads))
+	}
+	for _, payload := range payloads {
+		if !bytes.Equal(payload, audio) {
+			t.Errorf("%s: an audio page changed", name)
+		}
+	}
+}
+
+func TestWriteOgg(t *testing.T) {
+	long := strings.Repeat("Motörhead ", 7000) // more than a page
+
+	for name, test := range map[string]struct {
+		data  []byte
+		title string
+	}{
+		"same pages":  {oggFile("Overkill"), "Bomber"},
+		"more pages":  {oggFile("Overkill"), long},
+		"fewer pages": {oggFile(long), "Bomber"},
+	} {
+		checkOggPages(t, name+" before", test.data)
+
+		out, err := writeOgg(test.data, map[string]string{"title": test.title, "album": "Overkill"})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkOggPages(t, name, out)
+
+		m := readTags(t, out)
+		if m.Title() != test.title || m.Album() != "Overkill" {
+			t.Errorf("%s: read %.20q/%q", name, m.Title(), m.Album())
+		}
+	}
+}
+
+func TestWriteTagsReplacesTheFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "Overkill.mp3")
+	if err := ioutil.WriteFile(file, id3v24(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteTags(file, map[string]string{"year": "soon"}); err != ErrInvalidTag {
+		t.Errorf("an invalid year gave %v", err)
+	}
+	if err := WriteTags(file, map[string]string{"album": "Overkill"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := readTags(t, data); m.Album() != "Overkill" || m.Title() != "Overkill" {
+		t.Errorf("read %q/%q from the file", m.Title(), m.Album())
+	}
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(file), ".mmjs-*")); len(files) != 0 {
+		t.Errorf("temporary files were left behind: %v", files)
+	}
+}
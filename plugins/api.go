@@ -1,23 +1,75 @@
 package plugins
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/MeesCode/mmjs/audioplayer"
-	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/auth"
 	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/limits"
+	"github.com/MeesCode/mmjs/search"
 )
 
-var files = make([]globals.Track, 0)
+// maxLimit is the largest page a listing responds with
+const maxLimit = 1000
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// pageParams reads the page to list from the offset and limit in the url,
+// e.g. /search?query=queen&offset=10&limit=10. Without a limit the default is
+// used. Ok is false and an error has been written when they are not valid.
+func pageParams(w http.ResponseWriter, r *http.Request, defaultLimit int) (globals.Page, bool) {
+	page := globals.Page{Limit: defaultLimit}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"offset", &page.Offset}, {"limit", &page.Limit}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 {
+			http.Error(w, param.name+" should be a number of at least 0", http.StatusBadRequest)
+			return page, false
+		}
+		*param.value = i
+	}
+
+	if page.Limit == 0 || page.Limit > maxLimit {
+		page.Limit = maxLimit
+	}
+	return page, true
+}
+
+// writeList responds with a page of a list, the number of items on all pages
+// is in the X-Total-Count header.
+func writeList(w http.ResponseWriter, list interface{}, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	res, _ := json.Marshal(list)
+	fmt.Fprint(w, string(res))
+}
+
+// writeError logs an error of the library and responds with a fitting status
+// code: 501 when the mode does not support it, 404 for unknown tracks, 503
+// when the database did not answer in time and 500 for everything else.
+func writeError(w http.ResponseWriter, message string, err error) {
+	log.Println(message, err)
+	switch {
+	case errors.Is(err, library.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, library.ErrTrackNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, message+": the database did not respond in time", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
 	}
-	return b
 }
 
 func searchhandler(w http.ResponseWriter, r *http.Request) {
@@ -26,42 +78,48 @@ func searchhandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	key := query[0]
-	files = database.GetSearchResults(key)
-	files = files[:min(len(files), 10)]
-
-	res, _ := json.Marshal(files)
-	fmt.Fprintf(w, string(res))
+	page, ok := pageParams(w, r, 10)
+	if !ok {
+		return
+	}
+	tracks, total, err := library.Current.Search(key, page)
+	var syntaxErr *search.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		http.Error(w, syntaxErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, "could not perform search", err)
+		return
+	}
+	writeList(w, tracks, total)
 }
 
 func randomhandler(w http.ResponseWriter, r *http.Request) {
-	files = database.GetRandomTracks(10)
-	res, _ := json.Marshal(files)
+	tracks, err := library.Current.Random(10)
+	if err != nil {
+		writeError(w, "could not get random tracks", err)
+		return
+	}
+	res, _ := json.Marshal(tracks)
 	fmt.Fprintf(w, string(res))
 }
 
+// addhandler adds a track to the end of the queue by its id, /add?id=42
 func addhandler(w http.ResponseWriter, r *http.Request) {
-	query, ok := r.URL.Query()["query"]
-	if !ok || len(query[0]) < 1 {
-		return
-	}
-	key := query[0]
-	i, err := strconv.Atoi(key)
-
+	track, err := queuedTrack(r)
 	if err != nil {
-		fmt.Fprintf(w, "query could not be converted to integer")
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-
-	if len(files) > i {
-		track := files[i]
-		audioplayer.Addsong(track)
-
-		res, _ := json.Marshal(track)
-		fmt.Fprintf(w, string(res))
+	if err := allowAdd(r, 1); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
+	audioplayer.Addsong(track)
 
-	fmt.Fprintf(w, "track not found in current search query")
+	res, _ := json.Marshal(track)
+	fmt.Fprint(w, string(res))
 }
 
 func TogglePausehandler(w http.ResponseWriter, r *http.Request) {
@@ -101,27 +159,245 @@ func incplaycounterhandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	database.IncrementPlayCounter(i)
+	err = library.Current.IncrementPlays(i)
+	if err != nil {
+		writeError(w, "failed", err)
+		return
+	}
 	fmt.Fprintf(w, "success")
 }
 
+// ratehandler gives a track 1 to 5 stars, or removes the rating with 0, /rate?id=42&rating=4
+func ratehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	rating, ok := intParam(w, r, "rating")
+	if !ok {
+		return
+	}
+	writeRated(w, id, library.Current.SetRating(id, rating))
+}
+
+// favouritehandler marks a track as favourite, /favourite?id=42&value=1
+func favouritehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	value, ok := intParam(w, r, "value")
+	if !ok {
+		return
+	}
+	writeRated(w, id, library.Current.SetFavourite(id, value != 0))
+}
+
+// writeRated responds with the track after its rating or favourite changed
+func writeRated(w http.ResponseWriter, id int, err error) {
+	switch {
+	case errors.Is(err, library.ErrInvalidRating):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeError(w, "could not rate track", err)
+		return
+	}
+
+	track, err := library.Current.Track(id)
+	if err != nil {
+		writeError(w, "could not find track", err)
+		return
+	}
+	res, _ := json.Marshal(track)
+	fmt.Fprint(w, string(res))
+}
+
+// popularhandler returns the most played tracks, /popular?window=week. The window
+// is week, month or all (the default), recent plays weigh more than older ones.
 func popularhandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("handler")
-	files = database.GetPopularTracks(10)
-	res, _ := json.Marshal(files)
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "all"
+	}
+	tracks, err := library.Current.Popular(window, 10)
+	if errors.Is(err, library.ErrUnknownWindow) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, "could not get popular tracks", err)
+		return
+	}
+	res, _ := json.Marshal(tracks)
 	fmt.Fprintf(w, string(res))
 }
 
-// Webserver starts an entry port for https requests
+// similarhandler returns the tracks that are most like a track, /similar?id=42&n=10
+func similarhandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	n := 10
+	if r.URL.Query().Get("n") != "" {
+		if n, ok = intParam(w, r, "n"); !ok {
+			return
+		}
+	}
+
+	tracks, err := library.Current.Similar(id, n)
+	if err != nil {
+		writeError(w, "could not find similar tracks", err)
+		return
+	}
+
+	res, _ := json.Marshal(tracks)
+	fmt.Fprint(w, string(res))
+}
+
+// statshandler reports on the library and how it is listened to, /stats?top=10
+func statshandler(w http.ResponseWriter, r *http.Request) {
+	top := 10
+	if r.URL.Query().Get("top") != "" {
+		var ok bool
+		if top, ok = intParam(w, r, "top"); !ok {
+			return
+		}
+	}
+
+	// the state of the database is reported even when it is offline
+	report, err := library.Current.Stats(top)
+	if err != nil && !report.Database.Online && !errors.Is(err, library.ErrUnsupported) {
+		res, _ := json.Marshal(struct{ Database globals.Health }{report.Database})
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, string(res))
+		return
+	}
+	if err != nil {
+		writeError(w, "could not build statistics", err)
+		return
+	}
+
+	res, _ := json.Marshal(report)
+	fmt.Fprint(w, string(res))
+}
+
+// selectionFromQuery reads the tag values to browse by from the url,
+// for example ?artist=Queen&album=Innuendo
+func selectionFromQuery(r *http.Request) []globals.Group {
+	selection := make([]globals.Group, 0)
+	for _, tag := range []string{"genre", "decade", "year", "artist", "album"} {
+		if values, ok := r.URL.Query()[tag]; ok {
+			selection = append(selection, globals.Group{Tag: tag, Value: values[0]})
+		}
+	}
+	return selection
+}
+
+// browsehandler lists the values of a tag with their track counts,
+// e.g. /browse?tag=album&artist=Queen
+func browsehandler(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		tag = "artist"
+	}
+	page, ok := pageParams(w, r, 100)
+	if !ok {
+		return
+	}
+
+	groups, total, err := library.Current.Groups(tag, selectionFromQuery(r), page)
+	if errors.Is(err, library.ErrUnknownTag) {
+		http.Error(w, "can not browse by "+tag, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, "could not browse by "+tag, err)
+		return
+	}
+
+	writeList(w, groups, total)
+}
+
+// browsetrackshandler lists the tracks in a selection, e.g. /browse/tracks?artist=Queen
+func browsetrackshandler(w http.ResponseWriter, r *http.Request) {
+	page, ok := pageParams(w, r, 100)
+	if !ok {
+		return
+	}
+
+	tracks, total, err := library.Current.Selection(selectionFromQuery(r), page)
+	if err != nil {
+		writeError(w, "could not find tracks", err)
+		return
+	}
+
+	writeList(w, tracks, total)
+}
+
+// browseaddhandler adds all tracks in a selection to the queue, e.g. /browse/add?artist=Queen&album=Innuendo
+func browseaddhandler(w http.ResponseWriter, r *http.Request) {
+	selection := selectionFromQuery(r)
+	if len(selection) == 0 {
+		http.Error(w, "select at least an artist, album, genre, year or decade", http.StatusBadRequest)
+		return
+	}
+
+	tracks, _, err := library.Current.Selection(selection, globals.Page{})
+	if err != nil {
+		writeError(w, "could not find tracks", err)
+		return
+	}
+
+	// browsing shows banned tracks, but they are not queued
+	tracks = allowed(tracks)
+	for _, track := range tracks {
+		audioplayer.Addsong(track)
+	}
+
+	res, _ := json.Marshal(tracks)
+	fmt.Fprint(w, string(res))
+}
+
+// Webserver starts an entry port for https requests. Every handler needs a
+// role, guests may look around and add tracks, djs control the player and
+// admins manage the library and playlists.
 func Webserver() {
-	http.HandleFunc("/search", searchhandler)
-	http.HandleFunc("/add", addhandler)
-	http.HandleFunc("/skip", skiphandler)
-	http.HandleFunc("/queue", queuehandler)
-	http.HandleFunc("/TogglePause", TogglePausehandler)
-	http.HandleFunc("/random", randomhandler)
-	http.HandleFunc("/incplaycounter", incplaycounterhandler)
-	http.HandleFunc("/popular", popularhandler)
+	http.HandleFunc("/search", require(auth.Guest, limits.Search, searchhandler))
+	http.HandleFunc("/add", require(auth.Guest, limits.Add, addhandler))
+	http.HandleFunc("/skip", require(auth.DJ, limits.Control, skiphandler))
+	http.HandleFunc("/queue", require(auth.Guest, limits.Read, queuehandler))
+	http.HandleFunc("/TogglePause", require(auth.DJ, limits.Control, TogglePausehandler))
+	http.HandleFunc("/random", require(auth.Guest, limits.Search, randomhandler))
+	http.HandleFunc("/incplaycounter", require(auth.Admin, limits.Admin, incplaycounterhandler))
+	http.HandleFunc("/popular", require(auth.Guest, limits.Read, popularhandler))
+	http.HandleFunc("/similar", require(auth.Guest, limits.Read, similarhandler))
+	http.HandleFunc("/stats", require(auth.Guest, limits.Read, statshandler))
+	http.HandleFunc("/rate", require(auth.DJ, limits.Edit, ratehandler))
+	http.HandleFunc("/favourite", require(auth.DJ, limits.Edit, favouritehandler))
+	http.HandleFunc("/bans", require(auth.Admin, limits.Admin, banshandler))
+	http.HandleFunc("/bans/add", require(auth.Admin, limits.Admin, banaddhandler))
+	http.HandleFunc("/bans/remove", require(auth.Admin, limits.Admin, banremovehandler))
+	http.HandleFunc("/tags/edit", require(auth.Admin, limits.Admin, tagedithandler))
+	http.HandleFunc("/tags/history", require(auth.Admin, limits.Admin, taghistoryhandler))
+	http.HandleFunc("/browse", require(auth.Guest, limits.Read, browsehandler))
+	http.HandleFunc("/browse/tracks", require(auth.Guest, limits.Read, browsetrackshandler))
+	http.HandleFunc("/browse/add", require(auth.DJ, limits.Add, browseaddhandler))
+	http.HandleFunc("/playlists", require(auth.Guest, limits.Read, playlistshandler))
+	http.HandleFunc("/playlists/tracks", require(auth.Guest, limits.Read, playlisttrackshandler))
+	http.HandleFunc("/playlists/save", require(auth.Admin, limits.Admin, playlistsavehandler))
+	http.HandleFunc("/playlists/smart", require(auth.Admin, limits.Admin, playlistsmarthandler))
+	http.HandleFunc("/playlists/rules", require(auth.Admin, limits.Admin, playlistruleshandler))
+	http.HandleFunc("/playlists/rename", require(auth.Admin, limits.Admin, playlistrenamehandler))
+	http.HandleFunc("/playlists/delete", require(auth.Admin, limits.Admin, playlistdeletehandler))
+	http.HandleFunc("/playlists/overwrite", require(auth.Admin, limits.Admin, playlistoverwritehandler))
+	http.HandleFunc("/playlists/append", require(auth.Admin, limits.Admin, playlistappendhandler))
+	http.HandleFunc("/playlists/add", require(auth.Admin, limits.Admin, playlistaddhandler))
+	http.HandleFunc("/playlists/remove", require(auth.Admin, limits.Admin, playlistremovehandler))
+	http.HandleFunc("/playlists/move", require(auth.Admin, limits.Admin, playlistmovehandler))
+	http.HandleFunc("/playlists/load", require(auth.Admin, limits.Admin, playlistloadhandler))
+	registerAPI()
 
 	http.ListenAndServe(":"+strconv.Itoa(globals.Config.Webserver.Port), nil)
 }
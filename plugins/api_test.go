@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/metadata"
+)
+
+func TestAddByID(t *testing.T) {
+	openTestLibrary(t, "Queen/Bohemian Rhapsody.mp3", "Queen/100% Innuendo.mp3", "Toto/Africa.mp3")
+	audioplayer.Playlist = nil
+	defer func() { audioplayer.Playlist = nil }()
+
+	tracks, _, err := library.Current.Search("innuendo", globals.Page{})
+	if err != nil || len(tracks) != 1 {
+		t.Fatalf("search found %d tracks (%v), want 1", len(tracks), err)
+	}
+	want := tracks[0]
+
+	// somebody else searching in between does not change what is added
+	searchhandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/search?query=africa", nil))
+
+	w := httptest.NewRecorder()
+	addhandler(w, httptest.NewRequest("GET", "/add?id="+strconv.Itoa(want.ID), nil))
+	var added globals.Track
+	if err := json.Unmarshal(w.Body.Bytes(), &added); err != nil || added.Path != want.Path {
+		t.Fatalf("/add?id=%d answered %d %q, want %s", want.ID, w.Code, w.Body.String(), want.Path)
+	}
+	if len(audioplayer.Playlist) != 1 || audioplayer.Playlist[0].Path != want.Path {
+		t.Errorf("queue is %v, want only %s", audioplayer.Playlist, want.Path)
+	}
+
+	for query, status := range map[string]int{"": 400, "?id=x": 400, "?id=99": 404} {
+		w := httptest.NewRecorder()
+		addhandler(w, httptest.NewRequest("GET", "/add"+query, nil))
+		if w.Code != status {
+			t.Errorf("/add%s answered %d, want %d", query, w.Code, status)
+		}
+	}
+	if len(audioplayer.Playlist) != 1 {
+		t.Errorf("invalid adds changed the queue to %d tracks", len(audioplayer.Playlist))
+	}
+}
+
+func TestBrowseAdd(t *testing.T) {
+	openTestLibrary(t, "50%/Half.mp3", "50%/Full.mp3", "Toto/Africa.mp3")
+	if err := metadata.SetPatterns([]string{"/{artist}/{title}"}); err != nil {
+		t.Fatal(err)
+	}
+	defer metadata.SetPatterns(nil)
+	audioplayer.Playlist = nil
+	defer func() { audioplayer.Playlist = nil }()
+
+	w := httptest.NewRecorder()
+	browseaddhandler(w, httptest.NewRequest("GET", "/browse/add?artist=50%25", nil))
+	var added []globals.Track
+	if err := json.Unmarshal(w.Body.Bytes(), &added); err != nil || len(added) != 2 {
+		t.Fatalf("/browse/add?artist=50%%25 answered %d %q, want the 2 tracks of 50%%", w.Code, w.Body.String())
+	}
+	if len(audioplayer.Playlist) != 2 {
+		t.Errorf("queue has %d tracks, want 2", len(audioplayer.Playlist))
+	}
+
+	w = httptest.NewRecorder()
+	browseaddhandler(w, httptest.NewRequest("GET", "/browse/add", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("/browse/add without a selection answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,128 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/auth"
+	"github.com/MeesCode/mmjs/limits"
+)
+
+// command is what a command of the web interface needs: the role to use it
+// and the limit it counts towards
+type command struct {
+	role   auth.Role
+	action limits.Action
+}
+
+// the commands of the web interface, commands that are not in here can not
+// be used
+var commands = map[string]command{
+	"play":        {auth.DJ, limits.Control},
+	"pause":       {auth.DJ, limits.Control},
+	"next":        {auth.DJ, limits.Control},
+	"previous":    {auth.DJ, limits.Control},
+	"playtrack":   {auth.DJ, limits.Control},
+	"shuffle":     {auth.DJ, limits.Edit},
+	"rate":        {auth.DJ, limits.Edit},
+	"favourite":   {auth.DJ, limits.Edit},
+	"inserttrack": {auth.DJ, limits.Add},
+	"addtrack":    {auth.Guest, limits.Add},
+	"clear":       {auth.Admin, limits.Admin},
+}
+
+// denied returns the error for a user that may not do what needs a role,
+// 401 when they should log in and 403 when their role is too low.
+func denied(user auth.User, role auth.Role) error {
+	if user.Role == auth.Nobody {
+		return &apiError{http.StatusUnauthorized, "log in or use a token to do this"}
+	}
+	return &apiError{http.StatusForbidden, fmt.Sprintf("this needs the %s role", role)}
+}
+
+// limitRequest counts a request of a user towards the limit of its action.
+// Over the limit the Retry-After header is set and a 429 error returned.
+func limitRequest(w http.ResponseWriter, user auth.User, action limits.Action) error {
+	err := limits.Allow(user.ID(), action)
+	var limitErr *limits.Error
+	if errors.As(err, &limitErr) {
+		log.Println("Refused", action, "request of", user.ID(), err)
+		if w != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+		}
+		return &apiError{http.StatusTooManyRequests, err.Error()}
+	}
+	return err
+}
+
+// authenticate counts a request of a user towards the limit of its action and
+// checks that the user has at least a role. The request that is returned
+// carries the user.
+func authenticate(w http.ResponseWriter, r *http.Request, user auth.User, role auth.Role, action limits.Action) (*http.Request, error) {
+	if err := limitRequest(w, user, action); err != nil {
+		return r, err
+	}
+	if !user.Role.Allows(role) {
+		return r, denied(user, role)
+	}
+	return r.WithContext(auth.NewContext(r.Context(), user)), nil
+}
+
+// require wraps a handler of the webserver so only users with at least a role
+// may use it, and only as often as the limit of its action allows. These
+// handlers change things on a GET, so only a token counts and not the session.
+func require(role auth.Role, action limits.Action, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, err := authenticate(w, r, auth.IdentifyToken(r), role, action)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// allowAdd checks that the user of a request may add n tracks to the queue
+func allowAdd(r *http.Request, n int) error {
+	err := auth.AllowAdd(auth.FromContext(r.Context()), n)
+	var limitErr *auth.LimitError
+	if errors.As(err, &limitErr) {
+		return &apiError{http.StatusTooManyRequests, err.Error()}
+	}
+	return err
+}
+
+// loginhandler starts a session for the web interface, /login?name=dj&password=...
+// A POST is needed so passwords do not end up in the history by accident.
+func loginhandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST to log in", http.StatusMethodNotAllowed)
+		return
+	}
+	cookie, user, err := auth.Login(r.FormValue("name"), r.FormValue("password"))
+	if err != nil {
+		log.Println("Failed login for", r.FormValue("name"), err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, cookie)
+	res, _ := json.Marshal(user)
+	fmt.Fprint(w, string(res))
+}
+
+// logouthandler ends the session of the web interface, /logout
+func logouthandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, auth.Logout(r))
+	fmt.Fprint(w, "logged out")
+}
+
+// whoamihandler responds with the user of the web interface, /whoami
+func whoamihandler(w http.ResponseWriter, r *http.Request) {
+	res, _ := json.Marshal(auth.Identify(r))
+	fmt.Fprint(w, string(res))
+}
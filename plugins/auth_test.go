@@ -0,0 +1,63 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MeesCode/mmjs/auth"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/limits"
+)
+
+// enableTestAuth turns on auth with an admin that has a password and a
+// token, and returns the cookie of a session of that admin
+func enableTestAuth(t *testing.T) *http.Cookie {
+	t.Helper()
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals.Config.Auth.Enable = true
+	globals.Config.Auth.Anonymous = ""
+	globals.Config.Auth.Accounts = []globals.Account{{Name: "admin", Role: "admin", Password: hash, Token: "admintoken"}}
+	t.Cleanup(func() { globals.Config.Auth.Enable = false })
+
+	cookie, _, err := auth.Login("admin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie
+}
+
+func TestOldEndpointsIgnoreTheSession(t *testing.T) {
+	cookie := enableTestAuth(t)
+	handler := require(auth.Admin, limits.Admin, func(w http.ResponseWriter, r *http.Request) {})
+
+	// a link on another site sends the cookie along
+	r := httptest.NewRequest("GET", "/bans/remove?id=1", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("with a session the old endpoint answered %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r = httptest.NewRequest("GET", "/bans/remove?id=1&token=admintoken", nil)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("with a token the old endpoint answered %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// the session still counts for the api, which needs a POST to change things
+	rt := route{method: http.MethodPost, path: "/bans/remove", role: auth.Admin, action: limits.Admin,
+		handler: func(r *http.Request) (interface{}, error) { return nil, nil }}
+	r = httptest.NewRequest("POST", apiPrefix+"/bans/remove?id=1", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	rt.serve(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("with a session the api answered %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+)
+
+// allowed returns the tracks that may be queued from the web, banned tracks
+// are left out. When the ban list can not be read nothing is allowed.
+func allowed(tracks []globals.Track) []globals.Track {
+	tracks, err := library.Current.Allowed(tracks)
+	if err != nil {
+		log.Println("Could not read the ban list", err)
+		return nil
+	}
+	return tracks
+}
+
+// banError writes the error of a ban list operation with a fitting status
+// code. Returns whether there was an error.
+func banError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, library.ErrInvalidBan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, library.ErrBanNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		writeError(w, "ban list operation failed", err)
+	}
+	return true
+}
+
+// writeBans responds with the ban list, after a change to it
+func writeBans(w http.ResponseWriter) {
+	bans, err := library.Current.Bans()
+	if banError(w, err) {
+		return
+	}
+	res, _ := json.Marshal(bans)
+	fmt.Fprint(w, string(res))
+}
+
+// banshandler lists the ban list, /bans
+func banshandler(w http.ResponseWriter, r *http.Request) {
+	writeBans(w)
+}
+
+// banaddhandler bans a track, artist, genre or folder, e.g. /bans/add?kind=artist&value=Nickelback
+// or /bans/add?kind=folder&value=/Jokes. Tracks are banned by their id.
+func banaddhandler(w http.ResponseWriter, r *http.Request) {
+	_, err := library.Current.Ban(r.URL.Query().Get("kind"), r.URL.Query().Get("value"))
+	if banError(w, err) {
+		return
+	}
+	writeBans(w)
+}
+
+// banremovehandler lifts a ban, /bans/remove?id=3
+func banremovehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if banError(w, library.Current.Unban(id)) {
+		return
+	}
+	writeBans(w)
+}
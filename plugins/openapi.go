@@ -0,0 +1,190 @@
+package plugins
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/MeesCode/mmjs/auth"
+)
+
+// docsPage renders the OpenAPI document and lets people try the calls, it
+// has no dependencies so it also works without internet.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// schemas collects the OpenAPI schemas of the types the api responds with,
+// named structs become components that are referred to.
+type schemas map[string]interface{}
+
+// of returns the schema of a type
+func (c schemas) of(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": c.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": c.of(t.Elem())}
+	case reflect.Ptr:
+		return c.of(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.object(t)
+		}
+		if _, ok := c[t.Name()]; !ok {
+			c[t.Name()] = nil // types that contain themselves
+			c[t.Name()] = c.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct, with a property for every field that
+// encoding/json writes.
+func (c schemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = c.of(field.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// parameter returns the OpenAPI description of a query parameter
+func (p param) parameter() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        p.name,
+		"in":          "query",
+		"required":    p.required,
+		"description": p.description,
+		"schema":      map[string]interface{}{"type": p.kind},
+	}
+}
+
+// the parameters of every paged route, see pageValue
+var pageParameters = []param{
+	{"offset", "integer", false, "the number of items to skip"},
+	{"limit", "integer", false, "the number of items to return, at most 1000"},
+}
+
+// operation returns the OpenAPI description of a route
+func (rt route) operation(c schemas) map[string]interface{} {
+	params := rt.params
+	if rt.paged {
+		params = append(append([]param(nil), params...), pageParameters...)
+	}
+	parameters := make([]interface{}, 0, len(params))
+	for _, p := range params {
+		parameters = append(parameters, p.parameter())
+	}
+
+	ok := map[string]interface{}{
+		"description": "OK",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": c.of(reflect.TypeOf(rt.response))},
+		},
+	}
+	if rt.paged {
+		ok["headers"] = map[string]interface{}{
+			"X-Total-Count": map[string]interface{}{
+				"description": "the number of items on all pages",
+				"schema":      map[string]interface{}{"type": "integer"},
+			},
+		}
+	}
+
+	op := map[string]interface{}{
+		"summary":     rt.summary,
+		"operationId": strings.ToLower(rt.method) + strings.ReplaceAll(strings.Title(strings.ReplaceAll(rt.path, "/", " ")), " ", ""),
+		"parameters":  parameters,
+		"responses": map[string]interface{}{
+			"200":     ok,
+			"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+		},
+		"x-role":  rt.role,
+		"x-limit": rt.action,
+	}
+
+	// without credentials the anonymous role of the configuration is used
+	if rt.role != auth.Nobody {
+		op["description"] = "Needs the " + string(rt.role) + " role or higher, when auth is enabled."
+		op["security"] = []interface{}{
+			map[string]interface{}{"token": []string{}},
+			map[string]interface{}{"session": []string{}},
+			map[string]interface{}{},
+		}
+	}
+	return op
+}
+
+// openapi returns the OpenAPI document of the versioned api, it is built from
+// the routes so it always matches the handlers.
+func openapi() map[string]interface{} {
+	c := make(schemas)
+	c["Error"] = c.object(reflect.TypeOf(struct{ Error string }{}))
+
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		path, ok := paths[apiPrefix+rt.path].(map[string]interface{})
+		if !ok {
+			path = make(map[string]interface{})
+			paths[apiPrefix+rt.path] = path
+		}
+		path[strings.ToLower(rt.method)] = rt.operation(c)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "mmjs",
+			"version":     "1",
+			"description": "Control the jukebox: the queue, the player, the library and playlists. Everything that changes something is a POST, errors are {\"Error\": \"...\"} with a fitting status code. When auth is enabled, send a token as Authorization: Bearer <token> or log in for a session cookie. Guests may look around and add tracks, djs control the player and the queue and admins may do everything. Every operation except logging in and out is also a command on the websocket of the web interface, /socket?protocol=2: send {\"ID\": 1, \"Command\": \"queue/add\", \"Params\": {\"id\": 42}} and receive {\"Type\": \"result\", \"ID\": 1, \"Result\": ...} or {\"Type\": \"error\", \"ID\": 1, \"Status\": 404, \"Error\": \"...\"}.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": c,
+			"securitySchemes": map[string]interface{}{
+				"token":   map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": auth.SessionCookie},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "400 for an invalid request, 401 without valid credentials, 403 for banned tracks or a role that is too low, 404 when something does not exist, 405 for the wrong method, 409 for a conflict, 429 when a guest added too many tracks or a rate limit was hit (see the Retry-After header), 501 in filesystem mode, 503 when the database is unavailable and 500 for everything else",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openapihandler serves the OpenAPI document, /api/v1/openapi.json
+func openapihandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, http.StatusOK, openapi())
+}
+
+// docshandler serves the docs page, /api/v1/docs
+func docshandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,258 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/search"
+)
+
+// intParam reads an integer from the url, ok is false and an error has been
+// written when it is missing or not a number.
+func intParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		http.Error(w, name+" should be an integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return i, true
+}
+
+// playlistError writes the error of a playlist operation with a fitting
+// status code. Returns whether there was an error.
+func playlistError(w http.ResponseWriter, err error) bool {
+	var syntaxErr *search.SyntaxError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, library.ErrPlaylistExists), errors.Is(err, library.ErrSmartPlaylist), errors.Is(err, library.ErrNotSmart):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, library.ErrPlaylistNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, library.ErrInvalidPosition), errors.As(err, &syntaxErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeError(w, "playlist operation failed", err)
+	}
+	return true
+}
+
+// writePlaylists responds with all playlists, after a change to them
+func writePlaylists(w http.ResponseWriter) {
+	playlists, err := library.Current.Playlists()
+	if playlistError(w, err) {
+		return
+	}
+	res, _ := json.Marshal(playlists)
+	fmt.Fprint(w, string(res))
+}
+
+// writePlaylistTracks responds with a page of the tracks in a playlist, after
+// a change to it the entire playlist is sent.
+func writePlaylistTracks(w http.ResponseWriter, id int, page globals.Page) {
+	tracks, total, err := library.Current.PlaylistTracks(id, page)
+	if playlistError(w, err) {
+		return
+	}
+	writeList(w, tracks, total)
+}
+
+// playlistshandler lists all playlists, /playlists
+func playlistshandler(w http.ResponseWriter, r *http.Request) {
+	writePlaylists(w)
+}
+
+// playlisttrackshandler lists the tracks in a playlist, /playlists/tracks?id=1
+func playlisttrackshandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	page, ok := pageParams(w, r, 100)
+	if !ok {
+		return
+	}
+	writePlaylistTracks(w, id, page)
+}
+
+// playlistsavehandler saves the queue as a new playlist, /playlists/save?name=party
+func playlistsavehandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	_, err := library.Current.SavePlaylist(name, audioplayer.Playlist)
+	if playlistError(w, err) {
+		return
+	}
+	writePlaylists(w)
+}
+
+// playlistsmarthandler saves a smart playlist, /playlists/smart?name=metal&rules=genre:metal+sort:-plays
+func playlistsmarthandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	rules := r.URL.Query().Get("rules")
+	if name == "" || rules == "" {
+		http.Error(w, "name and rules are required", http.StatusBadRequest)
+		return
+	}
+	_, err := library.Current.SaveSmartPlaylist(name, rules)
+	if playlistError(w, err) {
+		return
+	}
+	writePlaylists(w)
+}
+
+// playlistruleshandler changes the rules of a smart playlist, /playlists/rules?id=1&rules=plays:0
+func playlistruleshandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.SetPlaylistRules(id, r.URL.Query().Get("rules"))) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistrenamehandler renames a playlist, /playlists/rename?id=1&name=party
+func playlistrenamehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if playlistError(w, library.Current.RenamePlaylist(id, name)) {
+		return
+	}
+	writePlaylists(w)
+}
+
+// playlistdeletehandler deletes a playlist, /playlists/delete?id=1
+func playlistdeletehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.DeletePlaylist(id)) {
+		return
+	}
+	writePlaylists(w)
+}
+
+// playlistoverwritehandler replaces the tracks of a playlist with the queue, /playlists/overwrite?id=1
+func playlistoverwritehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.OverwritePlaylist(id, audioplayer.Playlist)) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistappendhandler adds the queue to the end of a playlist, /playlists/append?id=1
+func playlistappendhandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.AppendToPlaylist(id, audioplayer.Playlist)) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistaddhandler adds a track to a playlist, at the end unless a position
+// is given, /playlists/add?id=1&track=42&position=0
+func playlistaddhandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	trackID, ok := intParam(w, r, "track")
+	if !ok {
+		return
+	}
+	position := -1
+	if r.URL.Query().Get("position") != "" {
+		if position, ok = intParam(w, r, "position"); !ok {
+			return
+		}
+	}
+	if _, err := library.Current.Track(trackID); err != nil {
+		writeError(w, "could not find track", err)
+		return
+	}
+	if playlistError(w, library.Current.AddPlaylistEntry(id, trackID, position)) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistremovehandler removes the track at a position from a playlist, /playlists/remove?id=1&position=3
+func playlistremovehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	position, ok := intParam(w, r, "position")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.RemovePlaylistEntry(id, position)) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistmovehandler moves a track within a playlist, /playlists/move?id=1&from=3&to=0
+func playlistmovehandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	from, ok := intParam(w, r, "from")
+	if !ok {
+		return
+	}
+	to, ok := intParam(w, r, "to")
+	if !ok {
+		return
+	}
+	if playlistError(w, library.Current.MovePlaylistEntry(id, from, to)) {
+		return
+	}
+	writePlaylistTracks(w, id, globals.Page{})
+}
+
+// playlistloadhandler replaces the queue with a playlist, /playlists/load?id=1
+func playlistloadhandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	tracks, _, err := library.Current.PlaylistTracks(id, globals.Page{})
+	if playlistError(w, err) {
+		return
+	}
+	tracks = allowed(tracks)
+	audioplayer.Clear()
+	audioplayer.Songindex = 0
+	audioplayer.Playlist = append([]globals.Track(nil), tracks...)
+	res, _ := json.Marshal(tracks)
+	fmt.Fprint(w, string(res))
+}
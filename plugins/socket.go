@@ -0,0 +1,167 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MeesCode/mmjs/auth"
+	"github.com/gorilla/websocket"
+)
+
+// the versions of the websocket protocol, clients choose one with
+// /socket?protocol=2. Version 1 is the text protocol of the first web
+// interface (play, next, addtrack:42, ...) and the default.
+const (
+	protocolText = 1
+	protocolJSON = 2
+)
+
+// clientsLock guards the clients and the writes to them, a websocket
+// connection does not support writing from more than one goroutine.
+var clientsLock sync.Mutex
+
+// Message is a command of a client in protocol 2, the path of a route of the
+// versioned api with its parameters, e.g.
+// {"ID": 1, "Command": "queue/add", "Params": {"id": 42}}. The ID is sent back
+// with the reply so clients can tell which command it belongs to.
+type Message struct {
+	ID      json.RawMessage
+	Command string
+	Params  map[string]interface{}
+}
+
+// Reply is what the server sends in protocol 2. The type is hello (once, right
+// after connecting), result or error (for a command) or state (every second).
+type Reply struct {
+	Type     string
+	ID       json.RawMessage `json:",omitempty"`
+	Protocol int             `json:",omitempty"`
+	User     *auth.User      `json:",omitempty"`
+	Result   interface{}     `json:",omitempty"`
+	Total    *int            `json:",omitempty"`
+	Status   int             `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+	State    *Stats          `json:",omitempty"`
+}
+
+// protocolVersion returns the protocol a client asks for
+func protocolVersion(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("protocol")
+	if value == "" {
+		return protocolText, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < protocolText || version > protocolJSON {
+		return 0, badRequest("unknown protocol %s, use 1 or 2", value)
+	}
+	return version, nil
+}
+
+// writeLocked sends a message to a client, clientsLock should be held. A
+// client that can not be written to is dropped.
+func writeLocked(ws *websocket.Conn, message []byte) {
+	if err := ws.WriteMessage(websocket.TextMessage, message); err != nil {
+		log.Printf("Websocket error: %s", err)
+		ws.Close()
+		delete(clients, ws)
+	}
+}
+
+// send sends a value as JSON to a client
+func send(ws *websocket.Conn, value interface{}) {
+	message, _ := json.Marshal(value)
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	writeLocked(ws, message)
+}
+
+// stateMessage returns the state in the format of a protocol
+func stateMessage(version int, state Stats) []byte {
+	var message []byte
+	if version == protocolJSON {
+		message, _ = json.Marshal(Reply{Type: "state", State: &state})
+	} else {
+		message, _ = json.Marshal(state)
+	}
+	return message
+}
+
+// findRoute returns the route of a command, every route of the versioned api
+// is a command except for logging in and out as the socket can not set cookies.
+func findRoute(command string) (route, bool) {
+	path := "/" + strings.TrimPrefix(command, "/")
+	if path == "/login" || path == "/logout" {
+		return route{}, false
+	}
+	for _, rt := range routes {
+		if rt.path == path {
+			return rt, true
+		}
+	}
+	return route{}, false
+}
+
+// call runs a command for a user like its route would for a http request
+func call(user auth.User, msg Message) (interface{}, error) {
+	rt, ok := findRoute(msg.Command)
+	if !ok {
+		return nil, &apiError{http.StatusNotFound, "no such command " + msg.Command}
+	}
+
+	values := make(url.Values)
+	for name, value := range msg.Params {
+		values.Set(name, fmt.Sprint(value))
+	}
+	r, err := http.NewRequest(rt.method, apiPrefix+rt.path+"?"+values.Encode(), nil)
+	if err != nil {
+		return nil, badRequest("invalid parameters")
+	}
+
+	if err := limitRequest(nil, user, rt.action); err != nil {
+		return nil, err
+	}
+	if !user.Role.Allows(rt.role) {
+		return nil, denied(user, rt.role)
+	}
+	return rt.handler(r.WithContext(auth.NewContext(r.Context(), user)))
+}
+
+// receiveJSON handles the commands of a client in protocol 2, every command
+// is answered with a result or an error.
+func receiveJSON(ws *websocket.Conn, user auth.User) {
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			log.Println("No message recieved:", err)
+			return
+		}
+
+		var msg Message
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&msg); err != nil {
+			send(ws, Reply{Type: "error", Status: http.StatusBadRequest, Error: "messages should be JSON: " + err.Error()})
+			continue
+		}
+
+		value, err := call(user, msg)
+		if err != nil {
+			status, message := errorMessage(err)
+			send(ws, Reply{Type: "error", ID: msg.ID, Status: status, Error: message})
+			continue
+		}
+
+		reply := Reply{Type: "result", ID: msg.ID, Result: value}
+		if l, ok := value.(list); ok {
+			reply.Result, reply.Total = l.items, &l.total
+		}
+		send(ws, reply)
+	}
+}
@@ -0,0 +1,88 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/metadata"
+)
+
+// tagedithandler changes tags of one or more tracks, only the fields in the url
+// are changed and an empty value removes the tag. With write=1 the tags are
+// also written to the files, e.g. /tags/edit?id=1&id=2&album=Innuendo&write=1
+func tagedithandler(w http.ResponseWriter, r *http.Request) {
+	ids := make([]int, 0)
+	for _, value := range r.URL.Query()["id"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "id should be an integer", http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		http.Error(w, "give at least one id", http.StatusBadRequest)
+		return
+	}
+
+	changes := make(map[string]string)
+	for _, field := range metadata.Fields {
+		if values, ok := r.URL.Query()[field]; ok {
+			changes[field] = values[0]
+		}
+	}
+
+	err := library.Current.EditTags(ids, changes, r.URL.Query().Get("write") == "1")
+	switch {
+	case errors.Is(err, library.ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, library.ErrWriteBack):
+		http.Error(w, err.Error()+", the library was changed anyway", http.StatusInternalServerError)
+		return
+	case err != nil:
+		writeError(w, "could not edit tags", err)
+		return
+	}
+
+	tracks := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		track, err := library.Current.Track(id)
+		if err == nil {
+			tracks = append(tracks, track)
+		}
+	}
+
+	res, _ := json.Marshal(tracks)
+	fmt.Fprint(w, string(res))
+}
+
+// taghistoryhandler returns the latest tag edits of a track, or of all tracks
+// without an id, /tags/history?id=42&n=20
+func taghistoryhandler(w http.ResponseWriter, r *http.Request) {
+	id, n := 0, 100
+	var ok bool
+	if r.URL.Query().Get("id") != "" {
+		if id, ok = intParam(w, r, "id"); !ok {
+			return
+		}
+	}
+	if r.URL.Query().Get("n") != "" {
+		if n, ok = intParam(w, r, "n"); !ok {
+			return
+		}
+	}
+
+	edits, err := library.Current.TagEdits(id, n)
+	if err != nil {
+		writeError(w, "could not read the tag history", err)
+		return
+	}
+
+	res, _ := json.Marshal(edits)
+	fmt.Fprint(w, string(res))
+}
@@ -0,0 +1,914 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/auth"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/limits"
+	"github.com/MeesCode/mmjs/search"
+	statistics "github.com/MeesCode/mmjs/stats"
+)
+
+// apiPrefix is where the versioned api lives, every route is below it
+const apiPrefix = "/api/v1"
+
+// route is an endpoint of the versioned api. The handler returns the value
+// to respond with as JSON, or an error that is turned into a status code. Only
+// users with at least the role may use it, as often as the limit of the action
+// allows. The rest describes the route in the OpenAPI document.
+type route struct {
+	method   string
+	path     string
+	role     auth.Role
+	action   limits.Action
+	summary  string
+	params   []param
+	paged    bool        // takes an offset and limit and sends X-Total-Count
+	response interface{} // a value of the type that is responded with
+	handler  func(r *http.Request) (interface{}, error)
+}
+
+// param is a parameter in the query string of a route, kind is the OpenAPI
+// type: integer, number or string.
+type param struct {
+	name        string
+	kind        string
+	required    bool
+	description string
+}
+
+// the parameters that select tracks by tag, see selectionFromQuery
+var selectionParams = []param{
+	{"genre", "string", false, "only tracks of this genre"},
+	{"decade", "integer", false, "only tracks from this decade, e.g. 1980"},
+	{"year", "integer", false, "only tracks from this year"},
+	{"artist", "string", false, "only tracks by this artist"},
+	{"album", "string", false, "only tracks on this album"},
+}
+
+// routes are all endpoints of the versioned api. Reading is done with GET,
+// everything that changes something needs a POST.
+var routes = []route{
+	{method: http.MethodPost, path: "/login", role: auth.Nobody, action: limits.Login, summary: "Log in with a name and password, the session is kept in a cookie",
+		params: []param{
+			{"name", "string", true, "the name of the account"},
+			{"password", "string", true, "its password"},
+		},
+		response: auth.User{}, handler: v1Login},
+	{method: http.MethodPost, path: "/logout", role: auth.Nobody, action: limits.Read, summary: "End the session",
+		response: auth.User{}, handler: v1Logout},
+	{method: http.MethodGet, path: "/me", role: auth.Nobody, action: limits.Read, summary: "Who you are and what role you have",
+		response: auth.User{}, handler: v1Me},
+	{method: http.MethodGet, path: "/queue", role: auth.Guest, action: limits.Read, summary: "The queue and the position of the track that is playing",
+		response: QueueState{}, handler: v1Queue},
+	{method: http.MethodPost, path: "/queue/add", role: auth.Guest, action: limits.Add, summary: "Add a track to the end of the queue",
+		params:   []param{{"id", "integer", true, "the track to add"}},
+		response: QueueState{}, handler: v1QueueAdd},
+	{method: http.MethodPost, path: "/queue/insert", role: auth.DJ, action: limits.Add, summary: "Insert a track into the queue",
+		params: []param{
+			{"id", "integer", true, "the track to insert"},
+			{"position", "integer", false, "where to insert it, right after the track that is playing by default"},
+		},
+		response: QueueState{}, handler: v1QueueInsert},
+	{method: http.MethodPost, path: "/queue/delete", role: auth.DJ, action: limits.Edit, summary: "Remove the track at a position of the queue",
+		params:   []param{{"position", "integer", true, "the position to remove, starting at 0"}},
+		response: QueueState{}, handler: v1QueueDelete},
+	{method: http.MethodPost, path: "/queue/move", role: auth.DJ, action: limits.Edit, summary: "Move a track to another position of the queue",
+		params: []param{
+			{"from", "integer", true, "the position of the track"},
+			{"to", "integer", true, "the position to move it to"},
+		},
+		response: QueueState{}, handler: v1QueueMove},
+	{method: http.MethodPost, path: "/queue/shuffle", role: auth.DJ, action: limits.Edit, summary: "Shuffle the queue, the track that is playing goes first",
+		response: QueueState{}, handler: v1QueueShuffle},
+	{method: http.MethodPost, path: "/queue/clear", role: auth.Admin, action: limits.Admin, summary: "Empty the queue and stop playing",
+		response: QueueState{}, handler: v1QueueClear},
+	{method: http.MethodGet, path: "/player", role: auth.Guest, action: limits.Read, summary: "What the player is doing",
+		response: PlayerState{}, handler: v1Player},
+	{method: http.MethodPost, path: "/player/play", role: auth.DJ, action: limits.Control, summary: "Play the track at a position of the queue, or resume",
+		params:   []param{{"position", "integer", false, "the position to play, without it playback is resumed"}},
+		response: PlayerState{}, handler: v1Play},
+	{method: http.MethodPost, path: "/player/pause", role: auth.DJ, action: limits.Control, summary: "Pause playback",
+		response: PlayerState{}, handler: v1Pause},
+	{method: http.MethodPost, path: "/player/seek", role: auth.DJ, action: limits.Control, summary: "Jump to a time in the track that is playing",
+		params:   []param{{"seconds", "number", true, "the time to jump to"}},
+		response: PlayerState{}, handler: v1Seek},
+	{method: http.MethodPost, path: "/player/volume", role: auth.DJ, action: limits.Control, summary: "Set the volume",
+		params:   []param{{"percent", "integer", true, "the volume from 0 to 100"}},
+		response: PlayerState{}, handler: v1Volume},
+	{method: http.MethodPost, path: "/player/next", role: auth.DJ, action: limits.Control, summary: "Play the next track in the queue",
+		response: PlayerState{}, handler: v1Next},
+	{method: http.MethodPost, path: "/player/previous", role: auth.DJ, action: limits.Control, summary: "Play the previous track in the queue",
+		response: PlayerState{}, handler: v1Previous},
+	{method: http.MethodGet, path: "/tracks", role: auth.Guest, action: limits.Read, summary: "A track by its id",
+		params:   []param{{"id", "integer", true, "the id of the track"}},
+		response: globals.Track{}, handler: v1Track},
+	{method: http.MethodPost, path: "/tracks/rate", role: auth.DJ, action: limits.Edit, summary: "Give a track 1 to 5 stars, or remove its rating with 0",
+		params: []param{
+			{"id", "integer", true, "the id of the track"},
+			{"rating", "integer", true, "the number of stars"},
+		},
+		response: globals.Track{}, handler: v1Rate},
+	{method: http.MethodPost, path: "/tracks/favourite", role: auth.DJ, action: limits.Edit, summary: "Mark a track as favourite, or not",
+		params: []param{
+			{"id", "integer", true, "the id of the track"},
+			{"value", "integer", true, "1 for a favourite, 0 for not"},
+		},
+		response: globals.Track{}, handler: v1Favourite},
+	{method: http.MethodGet, path: "/search", role: auth.Guest, action: limits.Search, summary: "Search the library, best match first",
+		params: []param{{"query", "string", true, "words and filters such as artist:queen year:1975..1980 -live"}},
+		paged:  true, response: []globals.Track{}, handler: v1Search},
+	{method: http.MethodGet, path: "/browse", role: auth.Guest, action: limits.Read, summary: "The values of a tag among the selected tracks, with their track counts",
+		params: append([]param{{"tag", "string", false, "artist (default), album, genre, year or decade"}}, selectionParams...),
+		paged:  true, response: []globals.Group{}, handler: v1Browse},
+	{method: http.MethodGet, path: "/browse/tracks", role: auth.Guest, action: limits.Read, summary: "The tracks that have every selected tag value",
+		params: selectionParams,
+		paged:  true, response: []globals.Track{}, handler: v1BrowseTracks},
+	{method: http.MethodGet, path: "/folders", role: auth.Guest, action: limits.Read, summary: "The folders and tracks directly inside a folder",
+		params: []param{{"path", "string", false, "the path of the folder, the root (/) by default"}},
+		paged:  true, response: FolderContents{}, handler: v1Folders},
+	{method: http.MethodGet, path: "/random", role: auth.Guest, action: limits.Search, summary: "Random tracks, banned tracks and tracks rated one star are left out",
+		params:   []param{{"n", "integer", false, "the number of tracks, 10 by default"}},
+		response: []globals.Track{}, handler: v1Random},
+	{method: http.MethodGet, path: "/popular", role: auth.Guest, action: limits.Read, summary: "The most played tracks, recent plays weigh more",
+		params: []param{
+			{"window", "string", false, "week, month or all (the default)"},
+			{"n", "integer", false, "the number of tracks, 10 by default"},
+		},
+		response: []globals.Track{}, handler: v1Popular},
+	{method: http.MethodGet, path: "/playlists", role: auth.Guest, action: limits.Read, summary: "All saved playlists",
+		response: []globals.Playlist{}, handler: v1Playlists},
+	{method: http.MethodGet, path: "/playlists/tracks", role: auth.Guest, action: limits.Read, summary: "The tracks in a playlist, in order",
+		params: []param{{"id", "integer", true, "the id of the playlist"}},
+		paged:  true, response: []globals.Track{}, handler: v1PlaylistTracks},
+	{method: http.MethodPost, path: "/playlists/save", role: auth.Admin, action: limits.Admin, summary: "Save the queue as a new playlist",
+		params:   []param{{"name", "string", true, "the name of the playlist"}},
+		response: []globals.Playlist{}, handler: v1PlaylistSave},
+	{method: http.MethodPost, path: "/playlists/smart", role: auth.Admin, action: limits.Admin, summary: "Save a playlist whose tracks are selected by a search query",
+		params: []param{
+			{"name", "string", true, "the name of the playlist"},
+			{"rules", "string", true, "a search query such as genre:metal sort:-plays limit:50"},
+		},
+		response: []globals.Playlist{}, handler: v1PlaylistSmart},
+	{method: http.MethodPost, path: "/playlists/rename", role: auth.Admin, action: limits.Admin, summary: "Rename a playlist",
+		params: []param{
+			{"id", "integer", true, "the id of the playlist"},
+			{"name", "string", true, "the new name"},
+		},
+		response: []globals.Playlist{}, handler: v1PlaylistRename},
+	{method: http.MethodPost, path: "/playlists/delete", role: auth.Admin, action: limits.Admin, summary: "Delete a playlist",
+		params:   []param{{"id", "integer", true, "the id of the playlist"}},
+		response: []globals.Playlist{}, handler: v1PlaylistDelete},
+	{method: http.MethodPost, path: "/playlists/load", role: auth.Admin, action: limits.Admin, summary: "Replace the queue with a playlist, banned tracks are left out",
+		params:   []param{{"id", "integer", true, "the id of the playlist"}},
+		response: QueueState{}, handler: v1PlaylistLoad},
+	{method: http.MethodPost, path: "/playlists/add", role: auth.Admin, action: limits.Admin, summary: "Add a track to a playlist",
+		params: []param{
+			{"id", "integer", true, "the id of the playlist"},
+			{"track", "integer", true, "the id of the track"},
+			{"position", "integer", false, "where to add it, at the end by default"},
+		},
+		response: []globals.Track{}, handler: v1PlaylistAdd},
+	{method: http.MethodPost, path: "/playlists/remove", role: auth.Admin, action: limits.Admin, summary: "Remove the track at a position of a playlist",
+		params: []param{
+			{"id", "integer", true, "the id of the playlist"},
+			{"position", "integer", true, "the position to remove, starting at 0"},
+		},
+		response: []globals.Track{}, handler: v1PlaylistRemove},
+	{method: http.MethodPost, path: "/playlists/move", role: auth.Admin, action: limits.Admin, summary: "Move a track to another position of a playlist",
+		params: []param{
+			{"id", "integer", true, "the id of the playlist"},
+			{"from", "integer", true, "the position of the track"},
+			{"to", "integer", true, "the position to move it to"},
+		},
+		response: []globals.Track{}, handler: v1PlaylistMove},
+	{method: http.MethodGet, path: "/stats", role: auth.Guest, action: limits.Read, summary: "Statistics on the library and how it is listened to",
+		params:   []param{{"top", "integer", false, "the number of top artists, albums and genres, 10 by default"}},
+		response: statistics.Report{}, handler: v1Stats},
+}
+
+// apiError is an error with the status code to respond with
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// badRequest returns an error for a request that can never succeed as it is
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// list is a page of a list, the number of items on all pages is sent in
+// the X-Total-Count header like the other listings of the webserver.
+type list struct {
+	items interface{}
+	total int
+}
+
+// session is the user that logged in or out, with the cookie that holds
+// their session
+type session struct {
+	cookie *http.Cookie
+	user   auth.User
+}
+
+// QueueState is the queue with the position of the track that is playing
+type QueueState struct {
+	Index  int
+	Tracks []globals.Track
+}
+
+// PlayerState is what the player is doing, times are in seconds and the
+// volume in percent
+type PlayerState struct {
+	Playing  bool
+	Index    int
+	Track    globals.Track
+	Progress float64
+	Length   float64
+	Volume   int
+}
+
+// FolderContents is a folder with a page of the folders and tracks directly
+// inside it, the folders come first. The parent is empty for the root.
+type FolderContents struct {
+	Path    string
+	Parent  string
+	Folders []globals.Folder
+	Tracks  []globals.Track
+}
+
+// errorStatus returns the status code for an error of a handler
+func errorStatus(err error) int {
+	var apiErr *apiError
+	var syntaxErr *search.SyntaxError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.status
+	case errors.As(err, &syntaxErr),
+		errors.Is(err, library.ErrUnknownTag),
+		errors.Is(err, library.ErrUnknownWindow),
+		errors.Is(err, library.ErrInvalidRating),
+		errors.Is(err, library.ErrInvalidPosition),
+		errors.Is(err, audioplayer.ErrInvalidPosition),
+		errors.Is(err, audioplayer.ErrInvalidVolume):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrLogin):
+		return http.StatusUnauthorized
+	case errors.Is(err, library.ErrTrackNotFound),
+		errors.Is(err, library.ErrFolderNotFound),
+		errors.Is(err, library.ErrPlaylistNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, library.ErrPlaylistExists),
+		errors.Is(err, library.ErrSmartPlaylist),
+		errors.Is(err, library.ErrNotSmart),
+		errors.Is(err, audioplayer.ErrNotSeekable):
+		return http.StatusConflict
+	case errors.Is(err, library.ErrUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON responds with a value as JSON
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	res, _ := json.Marshal(value)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(res))
+}
+
+// errorMessage returns the status code and message for an error of a handler.
+// The details of unexpected errors are only logged.
+func errorMessage(err error) (int, string) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Println("api request failed", err)
+		return status, "internal error"
+	}
+	return status, err.Error()
+}
+
+// writeAPIError responds with {"Error": "..."} and a fitting status code
+func writeAPIError(w http.ResponseWriter, err error) {
+	status, message := errorMessage(err)
+	writeJSON(w, status, struct{ Error string }{message})
+}
+
+// serve wraps a route into a http handler that checks the method, role and limit
+func (rt route) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != rt.method {
+		w.Header().Set("Allow", rt.method)
+		writeAPIError(w, &apiError{http.StatusMethodNotAllowed, "use " + rt.method + " for " + apiPrefix + rt.path})
+		return
+	}
+
+	r, err := authenticate(w, r, auth.Identify(r), rt.role, rt.action)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	value, err := rt.handler(r)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	switch v := value.(type) {
+	case list:
+		w.Header().Set("X-Total-Count", strconv.Itoa(v.total))
+		value = v.items
+	case session:
+		http.SetCookie(w, v.cookie)
+		value = v.user
+	}
+	writeJSON(w, http.StatusOK, value)
+}
+
+// registerAPI adds the routes of the versioned api to the webserver, unknown
+// paths below it are answered with a JSON 404.
+func registerAPI() {
+	for _, rt := range routes {
+		http.HandleFunc(apiPrefix+rt.path, rt.serve)
+	}
+	http.HandleFunc(apiPrefix+"/openapi.json", openapihandler)
+	http.HandleFunc(apiPrefix+"/docs", docshandler)
+	http.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{http.StatusNotFound, "no such endpoint " + r.URL.Path})
+	})
+}
+
+// intValue reads a required integer from the url
+func intValue(r *http.Request, name string) (int, error) {
+	i, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return 0, badRequest("%s should be an integer", name)
+	}
+	return i, nil
+}
+
+// optionalInt reads an integer from the url, or returns def when it is missing
+func optionalInt(r *http.Request, name string, def int) (int, error) {
+	if r.URL.Query().Get(name) == "" {
+		return def, nil
+	}
+	return intValue(r, name)
+}
+
+// pageValue reads the offset and limit of a listing from the url
+func pageValue(r *http.Request, defaultLimit int) (globals.Page, error) {
+	offset, err := optionalInt(r, "offset", 0)
+	if err != nil {
+		return globals.Page{}, err
+	}
+	limit, err := optionalInt(r, "limit", defaultLimit)
+	if err != nil {
+		return globals.Page{}, err
+	}
+	if offset < 0 || limit < 0 {
+		return globals.Page{}, badRequest("offset and limit should be at least 0")
+	}
+	if limit == 0 || limit > maxLimit {
+		limit = maxLimit
+	}
+	return globals.Page{Offset: offset, Limit: limit}, nil
+}
+
+// queuedTrack looks up the track to queue by its id, banned tracks can not
+// be queued from the web.
+func queuedTrack(r *http.Request) (globals.Track, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return globals.Track{}, err
+	}
+	track, err := library.Current.Track(id)
+	if err != nil {
+		return globals.Track{}, err
+	}
+	if len(allowed([]globals.Track{track})) == 0 {
+		return globals.Track{}, &apiError{http.StatusForbidden, "track is banned"}
+	}
+	return track, nil
+}
+
+// queueState returns the queue, after a change to it
+func queueState() QueueState {
+	return QueueState{Index: audioplayer.Songindex, Tracks: audioplayer.Playlist}
+}
+
+// playerState returns what the player is doing, after a change to it
+func playerState() PlayerState {
+	progress, length := audioplayer.GetPlaytime()
+	return PlayerState{
+		Playing:  audioplayer.IsPlaying(),
+		Index:    audioplayer.Songindex,
+		Track:    audioplayer.GetPlaying(),
+		Progress: progress.Seconds(),
+		Length:   length.Seconds(),
+		Volume:   audioplayer.Volume(),
+	}
+}
+
+// POST /api/v1/login with name and password in the query or a form
+func v1Login(r *http.Request) (interface{}, error) {
+	cookie, user, err := auth.Login(r.FormValue("name"), r.FormValue("password"))
+	if err != nil {
+		log.Println("Failed login for", r.FormValue("name"), err)
+		return nil, err
+	}
+	return session{cookie, user}, nil
+}
+
+// POST /api/v1/logout
+func v1Logout(r *http.Request) (interface{}, error) {
+	return session{auth.Logout(r), auth.User{Role: auth.Nobody}}, nil
+}
+
+// GET /api/v1/me
+func v1Me(r *http.Request) (interface{}, error) {
+	return auth.FromContext(r.Context()), nil
+}
+
+// GET /api/v1/queue
+func v1Queue(r *http.Request) (interface{}, error) {
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/add?id=42 adds a track to the end of the queue
+func v1QueueAdd(r *http.Request) (interface{}, error) {
+	track, err := queuedTrack(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := allowAdd(r, 1); err != nil {
+		return nil, err
+	}
+	audioplayer.Addsong(track)
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/insert?id=42&position=3 inserts a track into the queue,
+// without a position it is played next.
+func v1QueueInsert(r *http.Request) (interface{}, error) {
+	track, err := queuedTrack(r)
+	if err != nil {
+		return nil, err
+	}
+
+	next := 0
+	if len(audioplayer.Playlist) > 0 {
+		next = audioplayer.Songindex + 1
+	}
+	position, err := optionalInt(r, "position", next)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := audioplayer.InsertAt(position, track); err != nil {
+		return nil, err
+	}
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/delete?position=3
+func v1QueueDelete(r *http.Request) (interface{}, error) {
+	position, err := intValue(r, "position")
+	if err != nil {
+		return nil, err
+	}
+	if err := audioplayer.Remove(position); err != nil {
+		return nil, err
+	}
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/move?from=3&to=1
+func v1QueueMove(r *http.Request) (interface{}, error) {
+	from, err := intValue(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := intValue(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	if err := audioplayer.Move(from, to); err != nil {
+		return nil, err
+	}
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/shuffle
+func v1QueueShuffle(r *http.Request) (interface{}, error) {
+	audioplayer.Shuffle()
+	return queueState(), nil
+}
+
+// POST /api/v1/queue/clear
+func v1QueueClear(r *http.Request) (interface{}, error) {
+	audioplayer.Clear()
+	return queueState(), nil
+}
+
+// GET /api/v1/player
+func v1Player(r *http.Request) (interface{}, error) {
+	return playerState(), nil
+}
+
+// POST /api/v1/player/play?position=3 plays the track at a position of the
+// queue, without a position playback is resumed.
+func v1Play(r *http.Request) (interface{}, error) {
+	if len(audioplayer.Playlist) == 0 {
+		return nil, &apiError{http.StatusConflict, "the queue is empty"}
+	}
+
+	if r.URL.Query().Get("position") != "" {
+		position, err := intValue(r, "position")
+		if err != nil {
+			return nil, err
+		}
+		if position < 0 || position >= len(audioplayer.Playlist) {
+			return nil, audioplayer.ErrInvalidPosition
+		}
+		audioplayer.PlaySong(position)
+	} else if !audioplayer.WillPlay() {
+		audioplayer.PlaySong(audioplayer.Songindex)
+	} else if err := audioplayer.SetPause(false); err != nil {
+		return nil, err
+	}
+	return playerState(), nil
+}
+
+// POST /api/v1/player/pause
+func v1Pause(r *http.Request) (interface{}, error) {
+	if err := audioplayer.SetPause(true); err != nil {
+		return nil, err
+	}
+	return playerState(), nil
+}
+
+// POST /api/v1/player/seek?seconds=90.5
+func v1Seek(r *http.Request) (interface{}, error) {
+	seconds, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64)
+	if err != nil || seconds < 0 {
+		return nil, badRequest("seconds should be a number of at least 0")
+	}
+	if err := audioplayer.Seek(time.Duration(seconds * float64(time.Second))); err != nil {
+		return nil, err
+	}
+	return playerState(), nil
+}
+
+// POST /api/v1/player/volume?percent=80
+func v1Volume(r *http.Request) (interface{}, error) {
+	percent, err := intValue(r, "percent")
+	if err != nil {
+		return nil, err
+	}
+	if err := audioplayer.SetVolume(percent); err != nil {
+		return nil, err
+	}
+	return playerState(), nil
+}
+
+// POST /api/v1/player/next
+func v1Next(r *http.Request) (interface{}, error) {
+	audioplayer.Nextsong()
+	return playerState(), nil
+}
+
+// POST /api/v1/player/previous
+func v1Previous(r *http.Request) (interface{}, error) {
+	audioplayer.Previoussong()
+	return playerState(), nil
+}
+
+// GET /api/v1/tracks?id=42
+func v1Track(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	return library.Current.Track(id)
+}
+
+// rated responds with a track after its rating or favourite changed, the
+// copies in the queue are updated as well
+func rated(id int, command string, value int, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	updateQueuedTrack(id, command, value)
+	return library.Current.Track(id)
+}
+
+// POST /api/v1/tracks/rate?id=42&rating=4
+func v1Rate(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	rating, err := intValue(r, "rating")
+	if err != nil {
+		return nil, err
+	}
+	return rated(id, "rate", rating, library.Current.SetRating(id, rating))
+}
+
+// POST /api/v1/tracks/favourite?id=42&value=1
+func v1Favourite(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	value, err := intValue(r, "value")
+	if err != nil {
+		return nil, err
+	}
+	return rated(id, "favourite", value, library.Current.SetFavourite(id, value != 0))
+}
+
+// GET /api/v1/search?query=queen&offset=0&limit=10
+func v1Search(r *http.Request) (interface{}, error) {
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		return nil, badRequest("query is required")
+	}
+	page, err := pageValue(r, 10)
+	if err != nil {
+		return nil, err
+	}
+	tracks, total, err := library.Current.Search(query, page)
+	return list{tracks, total}, err
+}
+
+// GET /api/v1/browse?tag=album&artist=Queen
+func v1Browse(r *http.Request) (interface{}, error) {
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		tag = "artist"
+	}
+	page, err := pageValue(r, 100)
+	if err != nil {
+		return nil, err
+	}
+	groups, total, err := library.Current.Groups(tag, selectionFromQuery(r), page)
+	return list{groups, total}, err
+}
+
+// GET /api/v1/browse/tracks?artist=Queen&album=Innuendo
+func v1BrowseTracks(r *http.Request) (interface{}, error) {
+	page, err := pageValue(r, 100)
+	if err != nil {
+		return nil, err
+	}
+	tracks, total, err := library.Current.Selection(selectionFromQuery(r), page)
+	return list{tracks, total}, err
+}
+
+// GET /api/v1/folders?path=/Queen&offset=0&limit=100, the page is taken
+// from the folders and then the tracks
+func v1Folders(r *http.Request) (interface{}, error) {
+	folder, err := library.Current.Root()
+	if rpath := r.URL.Query().Get("path"); rpath != "" {
+		folder, err = library.Current.Folder(rpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	page, err := pageValue(r, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := FolderContents{Path: folder.Path}
+	if folder.Path != "/" {
+		parent, err := library.Current.Parent(folder)
+		if err != nil {
+			return nil, err
+		}
+		contents.Parent = parent.Path
+	}
+
+	folders, folderTotal, err := library.Current.Folders(folder, page)
+	if err != nil {
+		return nil, err
+	}
+
+	// the tracks continue where the folders stop, on a page full of folders
+	// they are only counted
+	trackPage := globals.Page{Offset: page.Offset - folderTotal, Limit: page.Limit - len(folders)}
+	if trackPage.Offset < 0 {
+		trackPage.Offset = 0
+	}
+	full := trackPage.Limit == 0
+	if full {
+		trackPage.Limit = 1
+	}
+	tracks, trackTotal, err := library.Current.Tracks(folder, trackPage)
+	if err != nil {
+		return nil, err
+	}
+	if full {
+		tracks = tracks[:0]
+	}
+
+	contents.Folders, contents.Tracks = folders, tracks
+	return list{contents, folderTotal + trackTotal}, nil
+}
+
+// countValue reads the number of items to list from the url, 10 by default
+func countValue(r *http.Request, name string) (int, error) {
+	n, err := optionalInt(r, name, 10)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > maxLimit {
+		return 0, badRequest("%s should be between 1 and %d", name, maxLimit)
+	}
+	return n, nil
+}
+
+// GET /api/v1/random?n=10
+func v1Random(r *http.Request) (interface{}, error) {
+	n, err := countValue(r, "n")
+	if err != nil {
+		return nil, err
+	}
+	return library.Current.Random(n)
+}
+
+// GET /api/v1/popular?window=month&n=10
+func v1Popular(r *http.Request) (interface{}, error) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "all"
+	}
+	n, err := countValue(r, "n")
+	if err != nil {
+		return nil, err
+	}
+	return library.Current.Popular(window, n)
+}
+
+// GET /api/v1/playlists
+func v1Playlists(r *http.Request) (interface{}, error) {
+	return library.Current.Playlists()
+}
+
+// GET /api/v1/playlists/tracks?id=1
+func v1PlaylistTracks(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	page, err := pageValue(r, 100)
+	if err != nil {
+		return nil, err
+	}
+	tracks, total, err := library.Current.PlaylistTracks(id, page)
+	return list{tracks, total}, err
+}
+
+// playlistsChanged responds with all playlists after a change to one of them
+func playlistsChanged(err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return library.Current.Playlists()
+}
+
+// POST /api/v1/playlists/save?name=party saves the queue as a playlist
+func v1PlaylistSave(r *http.Request) (interface{}, error) {
+	_, err := library.Current.SavePlaylist(r.URL.Query().Get("name"), audioplayer.Playlist)
+	return playlistsChanged(err)
+}
+
+// POST /api/v1/playlists/smart?name=metal&rules=genre:metal
+func v1PlaylistSmart(r *http.Request) (interface{}, error) {
+	_, err := library.Current.SaveSmartPlaylist(r.URL.Query().Get("name"), r.URL.Query().Get("rules"))
+	return playlistsChanged(err)
+}
+
+// POST /api/v1/playlists/rename?id=1&name=party
+func v1PlaylistRename(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	return playlistsChanged(library.Current.RenamePlaylist(id, r.URL.Query().Get("name")))
+}
+
+// POST /api/v1/playlists/delete?id=1
+func v1PlaylistDelete(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	return playlistsChanged(library.Current.DeletePlaylist(id))
+}
+
+// POST /api/v1/playlists/load?id=1 replaces the queue with a playlist
+func v1PlaylistLoad(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	tracks, _, err := library.Current.PlaylistTracks(id, globals.Page{})
+	if err != nil {
+		return nil, err
+	}
+	tracks = allowed(tracks)
+	audioplayer.Clear()
+	audioplayer.Songindex = 0
+	audioplayer.Playlist = append([]globals.Track(nil), tracks...)
+	return queueState(), nil
+}
+
+// playlistEntries responds with the tracks of a playlist after a change to them
+func playlistEntries(id int, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	tracks, total, err := library.Current.PlaylistTracks(id, globals.Page{})
+	return list{tracks, total}, err
+}
+
+// POST /api/v1/playlists/add?id=1&track=42&position=0, without a position
+// the track is added to the end.
+func v1PlaylistAdd(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	track, err := intValue(r, "track")
+	if err != nil {
+		return nil, err
+	}
+	position, err := optionalInt(r, "position", -1)
+	if err != nil {
+		return nil, err
+	}
+	return playlistEntries(id, library.Current.AddPlaylistEntry(id, track, position))
+}
+
+// POST /api/v1/playlists/remove?id=1&position=3
+func v1PlaylistRemove(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	position, err := intValue(r, "position")
+	if err != nil {
+		return nil, err
+	}
+	return playlistEntries(id, library.Current.RemovePlaylistEntry(id, position))
+}
+
+// POST /api/v1/playlists/move?id=1&from=3&to=0
+func v1PlaylistMove(r *http.Request) (interface{}, error) {
+	id, err := intValue(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	from, err := intValue(r, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := intValue(r, "to")
+	if err != nil {
+		return nil, err
+	}
+	return playlistEntries(id, library.Current.MovePlaylistEntry(id, from, to))
+}
+
+// GET /api/v1/stats?top=10, while the database is offline only its state is
+// sent with a 503.
+func v1Stats(r *http.Request) (interface{}, error) {
+	top, err := countValue(r, "top")
+	if err != nil {
+		return nil, err
+	}
+	report, err := library.Current.Stats(top)
+	if err != nil && !report.Database.Online && !errors.Is(err, library.ErrUnsupported) {
+		return nil, &apiError{http.StatusServiceUnavailable, "the database is offline"}
+	}
+	return report, err
+}
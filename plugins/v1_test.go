@@ -0,0 +1,78 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+)
+
+// openTestLibrary creates a filesystem library with the folders and (empty)
+// tracks at the given paths
+func openTestLibrary(t *testing.T, paths ...string) {
+	t.Helper()
+	globals.Root = t.TempDir()
+	for _, p := range paths {
+		file := filepath.Join(globals.Root, p)
+		if filepath.Ext(p) == "" {
+			if err := os.MkdirAll(file, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	library.Open("filesystem")
+}
+
+func TestFoldersArePaged(t *testing.T) {
+	openTestLibrary(t, "Queen/a/", "Queen/b/", "Queen/1.mp3", "Queen/2.mp3", "Queen/3.mp3")
+
+	// the folders come first, then the tracks
+	for _, test := range []struct {
+		query           string
+		folders, tracks int
+	}{
+		{"", 2, 3},
+		{"&limit=2", 2, 0},
+		{"&limit=3", 2, 1},
+		{"&offset=1&limit=2", 1, 1},
+		{"&offset=3", 0, 2},
+		{"&offset=9", 0, 0},
+	} {
+		value, err := v1Folders(httptest.NewRequest("GET", apiPrefix+"/folders?path=/Queen"+test.query, nil))
+		if err != nil {
+			t.Fatalf("%s: %s", test.query, err)
+		}
+		l := value.(list)
+		contents := l.items.(FolderContents)
+		if l.total != 5 || len(contents.Folders) != test.folders || len(contents.Tracks) != test.tracks {
+			t.Errorf("%s: got %d folders and %d tracks of %d, want %d and %d of 5",
+				test.query, len(contents.Folders), len(contents.Tracks), l.total, test.folders, test.tracks)
+		}
+	}
+
+	if _, err := v1Folders(httptest.NewRequest("GET", apiPrefix+"/folders?limit=-1", nil)); errorStatus(err) != 400 {
+		t.Errorf("a negative limit gave %v", err)
+	}
+}
+
+func TestStatsTopIsChecked(t *testing.T) {
+	openTestLibrary(t)
+	for _, top := range []int{-1, 0, maxLimit + 1} {
+		_, err := v1Stats(httptest.NewRequest("GET", fmt.Sprintf("%s/stats?top=%d", apiPrefix, top), nil))
+		if errorStatus(err) != 400 {
+			t.Errorf("top=%d gave %v, want a bad request", top, err)
+		}
+	}
+}
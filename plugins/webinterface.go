@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 	"strings"
 
 	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/auth"
 	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/limits"
 	"github.com/gorilla/websocket"
 )
 
@@ -19,25 +23,35 @@ type Stats struct {
 	Index    int
 	Length   time.Duration
 	Progress time.Duration
+	Database globals.Health
 }
 
-var clients = make(map[*websocket.Conn]bool)
+var clients = make(map[*websocket.Conn]int) // the protocol of every client
 var previousQueue []globals.Track
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin lets pages on other sites open the socket, but not with the
+// session of someone who logged in on the web interface
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !auth.HasSession(r) {
 		return true
-	},
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
-// check if two playlists are the same
+// check if two playlists are the same, including the ratings
 func identicalPlaylists(i1 []globals.Track, i2 []globals.Track) bool {
 	if len(i1) != len(i2) { return false }
 	for i, _ := range i1 {
-		log.Println("compare " + strconv.Itoa(i1[i].ID) + " and " + strconv.Itoa(i2[i].ID))
 		if i1[i].ID != i2[i].ID { return false }
+		if i1[i].Rating != i2[i].Rating || i1[i].Favourite != i2[i].Favourite { return false }
 	}
 	return true
 }
@@ -47,15 +61,28 @@ func page(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "plugins/webinterface.html")
 }
 
-// register client 
+// register client, only users that may at least look at the queue. The
+// protocol is chosen with /socket?protocol=2, see socket.go
 func stats(w http.ResponseWriter, r *http.Request) {
-	ws, err := upgrader.Upgrade(w, r, nil)
+	r, err := authenticate(w, r, auth.Identify(r), auth.Guest, limits.Read)
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
 	}
+	user := auth.FromContext(r.Context())
 
-	// register client
-	clients[ws] = true
+	version, err := protocolVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Could not open websocket", err)
+		return
+	}
+	defer ws.Close()
 
 	// send initial stats
 	var statobject Stats
@@ -63,22 +90,32 @@ func stats(w http.ResponseWriter, r *http.Request) {
 	statobject.Index = audioplayer.Songindex
 	statobject.Playing = audioplayer.IsPlaying()
 	statobject.Progress, statobject.Length = audioplayer.GetPlaytime()
+	statobject.Database = library.Current.Health()
 
-	queue, _ := json.Marshal(statobject)
+	// register client
+	clientsLock.Lock()
+	clients[ws] = version
+	if version == protocolJSON {
+		hello, _ := json.Marshal(Reply{Type: "hello", Protocol: protocolJSON, User: &user})
+		writeLocked(ws, hello)
+	}
+	writeLocked(ws, stateMessage(version, statobject))
+	clientsLock.Unlock()
 
-	err = ws.WriteMessage(websocket.TextMessage, []byte(queue))
-	if err != nil {
-		log.Printf("Websocket error: %s", err)
-		ws.Close()
-		delete(clients, ws)
+	if version == protocolJSON {
+		receiveJSON(ws, user)
+	} else {
+		receiver(ws, user)
 	}
 
-	defer ws.Close()
-	receiver(ws)
+	clientsLock.Lock()
+	delete(clients, ws)
+	clientsLock.Unlock()
 }
 
-// receive incoming command from a specific client
-func receiver(ws *websocket.Conn) {
+// receive incoming command from a specific client in protocol 1, commands the
+// user may not use or makes too often are ignored
+func receiver(ws *websocket.Conn, user auth.User) {
 	for {
 		// Read message from browser
 		_, msg, err := ws.ReadMessage()
@@ -94,6 +131,15 @@ func receiver(ws *websocket.Conn) {
 			args = strings.Split(c[1], ",")
 		}
 
+		needs, ok := commands[command]
+		if !ok || limitRequest(nil, user, needs.action) != nil {
+			continue
+		}
+		if !user.Role.Allows(needs.role) {
+			log.Println("Ignoring command", command, "of", user.Name, "with role", user.Role)
+			continue
+		}
+
 		switch command {
 		case "play":
 			if len(audioplayer.Playlist) == 0 { break }
@@ -119,8 +165,63 @@ func receiver(ws *websocket.Conn) {
 			audioplayer.Clear()
 			break
 		case "playtrack":
+			if len(args) == 0 { break }
 			index, err := strconv.Atoi(args[0])
-			if err == nil { audioplayer.PlaySong(index) }
+			if err == nil && index >= 0 && index < len(audioplayer.Playlist) { audioplayer.PlaySong(index) }
+		case "addtrack", "inserttrack":
+			if len(args) == 0 { break }
+			id, err := strconv.Atoi(args[0])
+			if err != nil { break }
+			track, err := library.Current.Track(id)
+			if err != nil {
+				log.Println("Could not find track to add", err)
+				break
+			}
+			if len(allowed([]globals.Track{track})) == 0 {
+				log.Println("Not adding banned track", track.Path)
+				break
+			}
+			if command == "addtrack" {
+				if err := auth.AllowAdd(user, 1); err != nil {
+					log.Println("Not adding track", track.Path, err)
+					break
+				}
+				audioplayer.Addsong(track)
+			} else {
+				audioplayer.Insertsong(track)
+			}
+		case "rate", "favourite":
+			// rate:<id>,<0-5> and favourite:<id>,<0|1>
+			if len(args) < 2 { break }
+			id, err := strconv.Atoi(args[0])
+			if err != nil { break }
+			value, err := strconv.Atoi(args[1])
+			if err != nil { break }
+			if command == "rate" {
+				err = library.Current.SetRating(id, value)
+			} else {
+				err = library.Current.SetFavourite(id, value != 0)
+			}
+			if err != nil {
+				log.Println("Could not rate track", err)
+				break
+			}
+			updateQueuedTrack(id, command, value)
+		}
+	}
+}
+
+// updateQueuedTrack copies a new rating or favourite to the tracks in the queue
+// so the change shows up in the next broadcast
+func updateQueuedTrack(id int, command string, value int) {
+	for i := range audioplayer.Playlist {
+		if audioplayer.Playlist[i].ID != id {
+			continue
+		}
+		if command == "rate" {
+			audioplayer.Playlist[i].Rating = value
+		} else {
+			audioplayer.Playlist[i].Favourite = value != 0
 		}
 	}
 }
@@ -136,6 +237,7 @@ func broadcaster() {
 		statobject.Index = audioplayer.Songindex
 		statobject.Playing = audioplayer.IsPlaying()
 		statobject.Progress, statobject.Length = audioplayer.GetPlaytime()
+		statobject.Database = library.Current.Health()
 
 		// update queue only if necessary
 		if identicalPlaylists(previousQueue, audioplayer.Playlist) && previousQueue != nil {
@@ -145,24 +247,27 @@ func broadcaster() {
 			previousQueue = append([]globals.Track(nil), audioplayer.Playlist...)
 		}
 
-		// get current stats in json format
-		queue, _ := json.Marshal(statobject)
+		// get current stats in json format, for both protocols
+		messages := map[int][]byte{
+			protocolText: stateMessage(protocolText, statobject),
+			protocolJSON: stateMessage(protocolJSON, statobject),
+		}
 
 		// send to every client that is currently connected
-		for client := range clients {
-			err := client.WriteMessage(websocket.TextMessage, []byte(queue))
-			if err != nil {
-				log.Printf("Websocket error: %s", err)
-				client.Close()
-				delete(clients, client)
-			}
+		clientsLock.Lock()
+		for client, version := range clients {
+			writeLocked(client, messages[version])
 		}
+		clientsLock.Unlock()
 	}
 }
 
 func Webinterface() {
 	http.HandleFunc("/", page)
 	http.HandleFunc("/socket", stats)
+	http.HandleFunc("/login", require(auth.Nobody, limits.Login, loginhandler))
+	http.HandleFunc("/logout", require(auth.Nobody, limits.Read, logouthandler))
+	http.HandleFunc("/whoami", require(auth.Nobody, limits.Read, whoamihandler))
 
 	// start broadcaster routine
 	go broadcaster()
@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+func TestIdenticalPlaylists(t *testing.T) {
+	// it runs every second, it should not log
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	queue := []globals.Track{{ID: 1}, {ID: 2, Rating: 3}}
+	same := []globals.Track{{ID: 1}, {ID: 2, Rating: 3}}
+	if !identicalPlaylists(queue, same) {
+		t.Error("equal queues are not identical")
+	}
+
+	for _, other := range [][]globals.Track{
+		{{ID: 1}},
+		{{ID: 2, Rating: 3}, {ID: 1}},
+		{{ID: 1}, {ID: 2, Rating: 4}},
+		{{ID: 1, Favourite: true}, {ID: 2, Rating: 3}},
+	} {
+		if identicalPlaylists(queue, other) {
+			t.Errorf("%v is identical to %v", other, queue)
+		}
+	}
+
+	if logged.Len() > 0 {
+		t.Errorf("comparing queues logged %q", logged.String())
+	}
+}
+
+func TestSocketChecksOriginOfSessions(t *testing.T) {
+	cookie := enableTestAuth(t)
+
+	for _, test := range []struct {
+		origin, token string
+		session, want bool
+	}{
+		{"", "", true, true},                              // not a browser
+		{"http://jukebox:8080", "", true, true},           // the web interface itself
+		{"http://evil.example", "", true, false},          // another site riding the session
+		{"http://evil.example", "", false, true},          // another site without a session
+		{"http://evil.example", "admintoken", true, true}, // a page that has its own token
+	} {
+		r := httptest.NewRequest("GET", "http://jukebox:8080/socket?token="+test.token, nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.session {
+			r.AddCookie(cookie)
+		}
+		if got := checkOrigin(r); got != test.want {
+			t.Errorf("origin %q, token %q, session %v: checkOrigin = %v, want %v",
+				test.origin, test.token, test.session, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package recommend finds tracks that are like a given track, from the tags they
+// share and from how often they end up together in playlists and listening sessions.
+package recommend
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// how much every kind of similarity adds to the score
+const (
+	weightArtist   = 3.0
+	weightAlbum    = 2.0
+	weightGenre    = 1.0
+	weightYear     = 0.5
+	weightPlaylist = 1.5
+	weightSession  = 1.0
+)
+
+// tracks within this many years of each other count as the same era
+const YearDistance = 2
+
+// plays within this many seconds of each other are in the same listening session
+const SessionGap = 30 * 60
+
+// Together holds for other tracks how often they were found together with
+// the track, by track ID.
+type Together struct {
+	Playlists map[int]int
+	Sessions  map[int]int
+}
+
+// Similar returns the n candidates that are most like the track, best first.
+// The track itself and tracks rated one star are never recommended.
+func Similar(track globals.Track, candidates []globals.Track, together Together, n int) []globals.Track {
+	type scored struct {
+		track globals.Track
+		score float64
+	}
+
+	results := make([]scored, 0)
+	seen := make(map[int]bool)
+	for _, candidate := range candidates {
+		if candidate.ID == track.ID || candidate.Rating == 1 || seen[candidate.ID] {
+			continue
+		}
+		seen[candidate.ID] = true
+
+		score := tagScore(track, candidate) +
+			weightPlaylist*math.Log2(1+float64(together.Playlists[candidate.ID])) +
+			weightSession*math.Log2(1+float64(together.Sessions[candidate.ID]))
+
+		if score > 0 {
+			results = append(results, scored{candidate, score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		if results[i].track.Plays != results[j].track.Plays {
+			return results[i].track.Plays > results[j].track.Plays
+		}
+		return results[i].track.Path < results[j].track.Path
+	})
+
+	tracks := make([]globals.Track, 0, n)
+	for _, result := range results {
+		if len(tracks) == n {
+			break
+		}
+		tracks = append(tracks, result.track)
+	}
+	return tracks
+}
+
+// tagScore scores the tags two tracks have in common
+func tagScore(a, b globals.Track) float64 {
+	score := 0.0
+	if same(a.Artist, b.Artist) {
+		score += weightArtist
+	}
+	if same(a.Album, b.Album) {
+		score += weightAlbum
+	}
+	if same(a.Genre, b.Genre) {
+		score += weightGenre
+	}
+	if a.Year.Valid && b.Year.Valid && math.Abs(float64(a.Year.Int64-b.Year.Int64)) <= YearDistance {
+		score += weightYear
+	}
+	return score
+}
+
+// same reports whether two tags are both known and equal, ignoring case
+func same(a, b sql.NullString) bool {
+	return a.Valid && b.Valid && a.String != "" && strings.EqualFold(a.String, b.String)
+}
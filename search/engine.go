@@ -0,0 +1,225 @@
+package search
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// the fields of a track that are searched, with how much a match in them counts
+const (
+	fieldTitle = iota
+	fieldArtist
+	fieldAlbum
+	fieldGenre
+	fieldPath
+	fieldCount
+)
+
+var fieldWeights = [fieldCount]float64{3, 2.5, 2, 1, 0.5}
+
+// how much the different kinds of word matches count
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.7
+	fuzzyMatch  = 0.5
+)
+
+// posting records that a word occurs in a field of a track
+type posting struct {
+	doc   int
+	field int
+}
+
+// Engine is an inverted index over a fixed set of tracks.
+// It is safe for concurrent searches once built.
+type Engine struct {
+	tracks []globals.Track
+	index  map[string][]posting
+	words  []string // sorted, for prefix lookups
+	titles []string // folded "artist title" of every track, for phrase bonuses
+}
+
+// Result is a track together with how well it matched.
+type Result struct {
+	Track globals.Track
+	Score float64
+}
+
+// NewEngine builds the index for the given tracks.
+func NewEngine(tracks []globals.Track) *Engine {
+	e := &Engine{
+		tracks: tracks,
+		index:  make(map[string][]posting),
+		titles: make([]string, len(tracks)),
+	}
+
+	for doc, track := range tracks {
+		fields := [fieldCount]string{
+			track.Title.String,
+			track.Artist.String,
+			track.Album.String,
+			track.Genre.String,
+			strings.TrimSuffix(track.Path, path.Ext(track.Path)),
+		}
+
+		for field, text := range fields {
+			seen := make(map[string]bool)
+			for _, word := range Tokenize(text) {
+				if seen[word] {
+					continue
+				}
+				seen[word] = true
+				e.index[word] = append(e.index[word], posting{doc: doc, field: field})
+			}
+		}
+
+		e.titles[doc] = strings.Join(Tokenize(track.Artist.String+" "+track.Title.String), " ")
+	}
+
+	e.words = make([]string, 0, len(e.index))
+	for word := range e.index {
+		e.words = append(e.words, word)
+	}
+	sort.Strings(e.words)
+
+	return e
+}
+
+// Len returns the number of tracks in the index.
+func (e *Engine) Len() int {
+	return len(e.tracks)
+}
+
+// expand finds every indexed word that matches a word of the query and how well.
+// Longer words tolerate more typos.
+func (e *Engine) expand(word string) map[string]float64 {
+	matches := make(map[string]float64)
+
+	if _, ok := e.index[word]; ok {
+		matches[word] = exactMatch
+	}
+
+	// words that start with the query word
+	i := sort.SearchStrings(e.words, word)
+	for ; i < len(e.words) && strings.HasPrefix(e.words[i], word); i++ {
+		if _, ok := matches[e.words[i]]; !ok {
+			matches[e.words[i]] = prefixMatch
+		}
+	}
+
+	typos := 0
+	if len(word) >= 8 {
+		typos = 2
+	} else if len(word) >= 4 {
+		typos = 1
+	}
+
+	if typos > 0 {
+		for _, candidate := range e.words {
+			if _, ok := matches[candidate]; ok {
+				continue
+			}
+			if distance(word, candidate, typos) <= typos {
+				matches[candidate] = fuzzyMatch
+			}
+		}
+	}
+
+	return matches
+}
+
+// Search returns the tracks that match the term, best match first. A track has
+// to match every word of the term, in any order and in any field. If no track
+// does, the tracks that match the most words are returned.
+func (e *Engine) Search(term string) []Result {
+	words := Tokenize(term)
+	if len(words) == 0 {
+		return nil
+	}
+
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+
+	for _, word := range words {
+		// the best score of this word for every track
+		best := make(map[int]float64)
+		for candidate, quality := range e.expand(word) {
+			for _, p := range e.index[candidate] {
+				score := quality * fieldWeights[p.field]
+				if score > best[p.doc] {
+					best[p.doc] = score
+				}
+			}
+		}
+
+		for doc, score := range best {
+			scores[doc] += score
+			matched[doc]++
+		}
+	}
+
+	// only keep the tracks that matched the most words
+	most := 0
+	for _, count := range matched {
+		if count > most {
+			most = count
+		}
+	}
+
+	phrase := strings.Join(words, " ")
+	results := make([]Result, 0)
+	for doc, score := range scores {
+		if matched[doc] < most {
+			continue
+		}
+
+		// reward the words appearing in the same order as in the track
+		if strings.Contains(e.titles[doc], phrase) {
+			score *= 1.5
+		}
+
+		results = append(results, Result{Track: e.tracks[doc], Score: score})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Track.Plays != results[j].Track.Plays {
+			return results[i].Track.Plays > results[j].Track.Plays
+		}
+		return results[i].Track.Path < results[j].Track.Path
+	})
+
+	return dedup(results)
+}
+
+// dedup removes a file that is in the results more than once. Tracks with
+// the same artist and title are kept, they can be a live version or another
+// master of the song.
+func dedup(results []Result) []Result {
+	seen := make(map[string]bool)
+	unique := make([]Result, 0, len(results))
+
+	for _, result := range results {
+		if seen[result.Track.Path] {
+			continue
+		}
+		seen[result.Track.Path] = true
+		unique = append(unique, result)
+	}
+
+	return unique
+}
+
+// Tracks returns only the tracks of the results.
+func Tracks(results []Result) []globals.Track {
+	tracks := make([]globals.Track, len(results))
+	for i, result := range results {
+		tracks[i] = result.Track
+	}
+	return tracks
+}
@@ -0,0 +1,29 @@
+package search
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+func TestSearchKeepsOtherVersions(t *testing.T) {
+	track := func(path string) globals.Track {
+		return globals.Track{
+			Path:   path,
+			Artist: sql.NullString{String: "Queen", Valid: true},
+			Title:  sql.NullString{String: "Bohemian Rhapsody", Valid: true},
+		}
+	}
+	engine := NewEngine([]globals.Track{
+		track("/Queen/A Night at the Opera/Bohemian Rhapsody.mp3"),
+		track("/Queen/Live Killers/Bohemian Rhapsody.mp3"),
+		track("/Remasters/Bohemian Rhapsody.mp3"),
+		track("/Remasters/Bohemian Rhapsody.mp3"),
+	})
+
+	results := engine.Search("bohemian rhapsody")
+	if len(results) != 3 {
+		t.Errorf("found %d tracks, want the 3 files once each: %v", len(results), Tracks(results))
+	}
+}
@@ -0,0 +1,90 @@
+// Package search ranks tracks by how well they match a search term. Matching
+// is done on accent and case folded words and tolerates small typos.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// letters that do not decompose into a base letter and an accent
+var special = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "þ", "th",
+)
+
+// Fold lowercases the text and strips all accents, so that "Beyoncé" and
+// "beyonce" are considered the same.
+func Fold(text string) string {
+	text = special.Replace(strings.ToLower(text))
+
+	var folded strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			folded.WriteRune(r)
+		}
+	}
+	return folded.String()
+}
+
+// Tokenize folds the text and splits it into words. Everything that is not
+// a letter or a digit separates words.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(Fold(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// distance returns the Levenshtein distance between two words,
+// giving up once it exceeds max.
+func distance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		best := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < best {
+				best = current[j]
+			}
+		}
+		if best > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,539 @@
+package search
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Query is a parsed search query such as
+//
+//	artist:queen year:1975..1980 genre:rock -live "under pressure"
+//
+// Free words are ranked by the Engine, everything else is a filter. The results
+// can be ordered with sort:field (sort:-field for descending, sort:random) and
+// cut off with limit:n.
+type Query struct {
+	Text       string
+	Filters    []Filter
+	Order      string
+	Descending bool
+	Limit      int
+}
+
+// Filter restricts the results to tracks where a field contains a text, or
+// where a numeric field is within a range. An empty Field means any text field.
+type Filter struct {
+	Field    string
+	Text     string
+	Min, Max int
+	Negate   bool
+}
+
+// the fields that can be filtered on
+var (
+	textFields    = []string{"artist", "title", "album", "genre", "path"}
+	numericFields = []string{"year", "plays", "rating", "favourite"}
+	sortFields    = []string{"artist", "title", "album", "genre", "path", "year", "plays", "rating", "favourite", "random"}
+)
+
+// no upper or lower limit for numeric ranges
+const (
+	noMin = -1 << 31
+	noMax = 1<<31 - 1
+)
+
+// SyntaxError describes what is wrong with a query and where.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (at position %d)", e.Msg, e.Pos+1)
+}
+
+// Parse parses a query. Malformed queries return a *SyntaxError explaining the problem.
+func Parse(input string) (Query, error) {
+	var query Query
+	var text []string
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		if runes[i] == ' ' || runes[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		negate := false
+		if runes[i] == '-' && i+1 < len(runes) && runes[i+1] != ' ' {
+			negate = true
+			i++
+		}
+
+		// a quoted phrase
+		if runes[i] == '"' {
+			phrase, next, err := readQuoted(runes, i)
+			if err != nil {
+				return Query{}, err
+			}
+			i = next
+
+			if strings.TrimSpace(phrase) == "" {
+				continue
+			}
+			if !negate {
+				text = append(text, phrase)
+			}
+			query.Filters = append(query.Filters, Filter{Text: Fold(phrase), Negate: negate})
+			continue
+		}
+
+		// a word, possibly with a field
+		wordStart := i
+		for i < len(runes) && runes[i] != ' ' && runes[i] != '\t' && runes[i] != ':' && runes[i] != '"' {
+			i++
+		}
+
+		if i >= len(runes) || runes[i] != ':' {
+			word := string(runes[wordStart:i])
+			if i < len(runes) && runes[i] == '"' {
+				return Query{}, &SyntaxError{Pos: i, Msg: "unexpected quote, put a space before it"}
+			}
+			if negate {
+				// a lone - would exclude every track
+				if Fold(word) != "" {
+					query.Filters = append(query.Filters, Filter{Text: Fold(word), Negate: true})
+				}
+			} else {
+				text = append(text, word)
+			}
+			continue
+		}
+
+		field := strings.ToLower(string(runes[wordStart:i]))
+		i++
+
+		var value string
+		valueStart := i
+		if i < len(runes) && runes[i] == '"' {
+			var err error
+			value, i, err = readQuoted(runes, i)
+			if err != nil {
+				return Query{}, err
+			}
+		} else {
+			for i < len(runes) && runes[i] != ' ' && runes[i] != '\t' {
+				i++
+			}
+			value = string(runes[valueStart:i])
+		}
+
+		if field == "sort" || field == "limit" {
+			if negate {
+				return Query{}, &SyntaxError{Pos: start, Msg: field + ": cannot be excluded"}
+			}
+			if err := query.parseArrangement(field, value, valueStart); err != nil {
+				return Query{}, err
+			}
+			continue
+		}
+
+		filter, err := parseFilter(field, value, start, valueStart)
+		if err != nil {
+			return Query{}, err
+		}
+		filter.Negate = negate
+		query.Filters = append(query.Filters, filter)
+	}
+
+	query.Text = strings.Join(text, " ")
+	return query, nil
+}
+
+// readQuoted reads a quoted string starting at the opening quote, it returns
+// the contents and the position after the closing quote.
+func readQuoted(runes []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '"' {
+			return string(runes[start+1 : i]), i + 1, nil
+		}
+	}
+	return "", 0, &SyntaxError{Pos: start, Msg: "missing closing quote"}
+}
+
+// parseArrangement handles sort:field and limit:n
+func (q *Query) parseArrangement(field string, value string, valuePos int) error {
+	if value == "" {
+		return &SyntaxError{Pos: valuePos, Msg: "missing value after " + field + ":"}
+	}
+
+	if field == "limit" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return &SyntaxError{Pos: valuePos, Msg: "limit: should be a number above 0"}
+		}
+		q.Limit = n
+		return nil
+	}
+
+	q.Descending = strings.HasPrefix(value, "-")
+	q.Order = strings.ToLower(strings.TrimPrefix(value, "-"))
+	if !globals.Contains(sortFields, q.Order) {
+		return &SyntaxError{Pos: valuePos, Msg: "cannot sort by \"" + q.Order + "\", use one of " + strings.Join(sortFields, ", ")}
+	}
+	return nil
+}
+
+// parseFilter turns field:value into a filter
+func parseFilter(field string, value string, pos int, valuePos int) (Filter, error) {
+	if value == "" {
+		return Filter{}, &SyntaxError{Pos: valuePos, Msg: "missing value after " + field + ":"}
+	}
+
+	if globals.Contains(textFields, field) {
+		return Filter{Field: field, Text: Fold(value)}, nil
+	}
+
+	if !globals.Contains(numericFields, field) {
+		return Filter{}, &SyntaxError{Pos: pos, Msg: "unknown field \"" + field + "\", use one of " +
+			strings.Join(append(append([]string{}, textFields...), numericFields...), ", ") +
+			", sort, limit or put the text in quotes"}
+	}
+
+	// favourite:yes reads better than favourite:1
+	if field == "favourite" {
+		switch strings.ToLower(value) {
+		case "yes", "true":
+			value = "1"
+		case "no", "false":
+			value = "0"
+		}
+	}
+
+	min, max, err := parseRange(value)
+	if err != nil {
+		return Filter{}, &SyntaxError{Pos: valuePos, Msg: field + ": " + err.Error()}
+	}
+
+	return Filter{Field: field, Min: min, Max: max}, nil
+}
+
+// parseRange parses 1975, 1975..1980, ..1980, 1975.., >1975, >=1975, <1980 and <=1980
+func parseRange(value string) (int, int, error) {
+	number := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", s)
+		}
+		return n, nil
+	}
+
+	switch {
+	case strings.HasPrefix(value, ">="):
+		n, err := number(value[2:])
+		return n, noMax, err
+	case strings.HasPrefix(value, "<="):
+		n, err := number(value[2:])
+		return noMin, n, err
+	case strings.HasPrefix(value, ">"):
+		n, err := number(value[1:])
+		return n + 1, noMax, err
+	case strings.HasPrefix(value, "<"):
+		n, err := number(value[1:])
+		return noMin, n - 1, err
+	}
+
+	if !strings.Contains(value, "..") {
+		n, err := number(value)
+		return n, n, err
+	}
+
+	parts := strings.SplitN(value, "..", 2)
+	min, max := noMin, noMax
+	var err error
+
+	if parts[0] == "" && parts[1] == "" {
+		return 0, 0, fmt.Errorf("a range needs at least one end, like 1975..1980")
+	}
+	if parts[0] != "" {
+		if min, err = number(parts[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if parts[1] != "" {
+		if max, err = number(parts[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("the range %s is empty, the start is after the end", value)
+	}
+
+	return min, max, nil
+}
+
+// textOf returns the folded contents of a text field of a track
+func textOf(track globals.Track, field string) string {
+	switch field {
+	case "artist":
+		return Fold(track.Artist.String)
+	case "title":
+		return Fold(track.Title.String)
+	case "album":
+		return Fold(track.Album.String)
+	case "genre":
+		return Fold(track.Genre.String)
+	case "path":
+		return Fold(track.Path)
+	}
+	return ""
+}
+
+// numberOf returns the value of a numeric field of a track, false if it is unknown
+func numberOf(track globals.Track, field string) (int, bool) {
+	switch field {
+	case "year":
+		return int(track.Year.Int64), track.Year.Valid
+	case "plays":
+		return track.Plays, true
+	case "rating":
+		return track.Rating, true
+	case "favourite":
+		if track.Favourite {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// matches reports whether the track satisfies the filter, ignoring negation
+func (f Filter) matches(track globals.Track) bool {
+	if globals.Contains(numericFields, f.Field) {
+		n, ok := numberOf(track, f.Field)
+		return ok && n >= f.Min && n <= f.Max
+	}
+
+	if f.Field != "" {
+		return strings.Contains(textOf(track, f.Field), f.Text)
+	}
+
+	for _, field := range textFields {
+		if strings.Contains(textOf(track, field), f.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the track satisfies every filter of the query.
+// The free text is not checked, that is up to the Engine.
+func (q Query) Match(track globals.Track) bool {
+	for _, filter := range q.Filters {
+		if filter.matches(track) == filter.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// columns maps the fields to their database columns
+var columns = map[string]string{
+	"artist":    "Artist",
+	"title":     "Title",
+	"album":     "Album",
+	"genre":     "Genre",
+	"path":      "Path",
+	"year":      "Year",
+	"plays":     "Plays",
+	"rating":    "Rating",
+	"favourite": "Favourite",
+}
+
+// SQL translates the filters into a where clause with its arguments, for use
+// on the Tracks table. The free text is not included. Text is compared folded,
+// without case and accents, which LOWER and LIKE only do the same way for
+// ascii. Other text is let through, so the clause selects at least the tracks
+// that Match accepts and Match has to check text filters afterwards, see Exact.
+func (q Query) SQL() (string, []interface{}) {
+	clauses := make([]string, 0, len(q.Filters))
+	args := make([]interface{}, 0)
+
+	for _, f := range q.Filters {
+		var clause string
+
+		switch {
+		case globals.Contains(numericFields, f.Field):
+			clause = "(" + columns[f.Field] + " IS NOT NULL"
+			if f.Min != noMin {
+				clause += " AND " + columns[f.Field] + " >= ?"
+				args = append(args, f.Min)
+			}
+			if f.Max != noMax {
+				clause += " AND " + columns[f.Field] + " <= ?"
+				args = append(args, f.Max)
+			}
+			clause += ")"
+			if f.Negate {
+				clause = "NOT " + clause
+			}
+		case f.Field != "":
+			clause = textClause(f.Field, f.Negate)
+			args = append(args, likePattern(f.Text))
+		case f.Negate:
+			// none of the fields may surely contain the text
+			sure := make([]string, 0, len(textFields))
+			for _, field := range textFields {
+				sure = append(sure, textClause(field, false))
+				args = append(args, likePattern(f.Text))
+			}
+			clause = "NOT (" + strings.Join(sure, " OR ") + ")"
+		default:
+			any := make([]string, 0, len(textFields))
+			for _, field := range textFields {
+				any = append(any, textClause(field, false))
+				args = append(args, likePattern(f.Text))
+			}
+			clause = "(" + strings.Join(any, " OR ") + ")"
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 0 {
+		return "1 = 1", args
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// textClause returns the clause of a text filter on a field. A column that is
+// not plain ascii may hold the text once folded, so it is always let through.
+// Negated, the column has to be ascii and must not hold the text.
+func textClause(field string, negate bool) string {
+	column := "COALESCE(" + columns[field] + ", '')"
+	if negate {
+		return "(NOT " + ascii(column) + " OR LOWER(" + column + ") NOT LIKE ? ESCAPE '!')"
+	}
+	return "(NOT " + ascii(column) + " OR LOWER(" + column + ") LIKE ? ESCAPE '!')"
+}
+
+// ascii returns the condition that a column only holds ascii characters, by
+// comparing its length in characters and in bytes
+func ascii(column string) string {
+	if globals.Config.Database.Driver == "sqlite" {
+		return "LENGTH(" + column + ") = LENGTH(CAST(" + column + " AS BLOB))"
+	}
+	return "CHAR_LENGTH(" + column + ") = LENGTH(" + column + ")"
+}
+
+// likePattern returns the LIKE pattern for text anywhere in a column. The
+// wildcards % and _ in the text are escaped with !.
+func likePattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Exact reports whether the clause of SQL selects exactly the tracks that
+// Match accepts, so the database can page the results itself. That is only
+// the case without text filters.
+func (q Query) Exact() bool {
+	for _, f := range q.Filters {
+		if !globals.Contains(numericFields, f.Field) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the tracks that satisfy every filter of the query, sorted
+// by artist, album and path. This is used when there is no free text to rank.
+func (q Query) Filter(tracks []globals.Track) []globals.Track {
+	filtered := make([]globals.Track, 0)
+	for _, track := range tracks {
+		if q.Match(track) {
+			filtered = append(filtered, track)
+		}
+	}
+	Sort(filtered)
+	return filtered
+}
+
+// Rank ranks the tracks of the engine by the free text, best match first, and
+// only keeps the ones that are accepted by keep.
+func (q Query) Rank(engine *Engine, keep func(globals.Track) bool) []globals.Track {
+	results := make([]globals.Track, 0)
+	for _, result := range engine.Search(q.Text) {
+		if keep(result.Track) {
+			results = append(results, result.Track)
+		}
+	}
+	return results
+}
+
+// IsEmpty reports whether the query asks for nothing at all. A query with only
+// a sort or limit selects the entire library.
+func (q Query) IsEmpty() bool {
+	return q.Text == "" && len(q.Filters) == 0 && q.Order == "" && q.Limit == 0
+}
+
+// Arrange applies the sort and limit of the query to the results. Without
+// a sort the order of the results is kept.
+func (q Query) Arrange(tracks []globals.Track) []globals.Track {
+	switch q.Order {
+	case "":
+	case "random":
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		random.Shuffle(len(tracks), func(i, j int) {
+			tracks[i], tracks[j] = tracks[j], tracks[i]
+		})
+	default:
+		sort.SliceStable(tracks, func(i, j int) bool {
+			if q.Descending {
+				return less(tracks[j], tracks[i], q.Order)
+			}
+			return less(tracks[i], tracks[j], q.Order)
+		})
+	}
+
+	if q.Limit > 0 && len(tracks) > q.Limit {
+		tracks = tracks[:q.Limit]
+	}
+	return tracks
+}
+
+// less compares two tracks on a field, unknown numbers come last
+func less(a, b globals.Track, field string) bool {
+	if globals.Contains(numericFields, field) {
+		x, okx := numberOf(a, field)
+		y, oky := numberOf(b, field)
+		if okx != oky {
+			return okx
+		}
+		return x < y
+	}
+	return textOf(a, field) < textOf(b, field)
+}
+
+// Sort orders tracks by artist, album and path
+func Sort(tracks []globals.Track) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.Artist.String != b.Artist.String {
+			return Fold(a.Artist.String) < Fold(b.Artist.String)
+		}
+		if a.Album.String != b.Album.String {
+			return Fold(a.Album.String) < Fold(b.Album.String)
+		}
+		return path.Base(a.Path) < path.Base(b.Path)
+	})
+}
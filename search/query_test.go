@@ -0,0 +1,46 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+func TestParseDropsLoneMinus(t *testing.T) {
+	for _, input := range []string{"queen -\t", "queen -", "queen - live", "queen -́"} {
+		query, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		for _, filter := range query.Filters {
+			if filter.Text == "" {
+				t.Errorf("%q: filter with empty text %+v", input, filter)
+			}
+		}
+	}
+}
+
+func TestSQLPrefiltersText(t *testing.T) {
+	globals.Config.Database.Driver = "sqlite"
+	defer func() { globals.Config.Database.Driver = "" }()
+
+	query, err := Parse("artist:50%_ -genre:pop year:1990")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	where, args := query.SQL()
+	want := "(NOT LENGTH(COALESCE(Artist, '')) = LENGTH(CAST(COALESCE(Artist, '') AS BLOB)) OR LOWER(COALESCE(Artist, '')) LIKE ? ESCAPE '!')" +
+		" AND (NOT LENGTH(COALESCE(Genre, '')) = LENGTH(CAST(COALESCE(Genre, '') AS BLOB)) OR LOWER(COALESCE(Genre, '')) NOT LIKE ? ESCAPE '!')" +
+		" AND (Year IS NOT NULL AND Year >= ? AND Year <= ?)"
+	if where != want {
+		t.Errorf("where is\n%s\nwant\n%s", where, want)
+	}
+	if fmt.Sprint(args) != "[%50!%!_% %pop% 1990 1990]" {
+		t.Errorf("args are %v", args)
+	}
+	if query.Exact() {
+		t.Error("a query with text filters is exact")
+	}
+}
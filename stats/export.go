@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// groupName shows a group value, tracks without the tag are unknown
+func groupName(group globals.Group) string {
+	if group.Value == "" {
+		return "unknown"
+	}
+	return group.Value
+}
+
+// WriteText writes the report in a human readable form
+func WriteText(w io.Writer, report Report) {
+	fmt.Fprintf(w, "tracks:       %d\n", report.Tracks)
+	fmt.Fprintf(w, "plays:        %d\n", report.Plays)
+	fmt.Fprintf(w, "never played: %d\n", report.NeverPlayed)
+	fmt.Fprintf(w, "untagged:     %d (%.1f%%)\n", report.Untagged, report.UntaggedPercent)
+
+	writeGroups := func(title string, groups []globals.Group) {
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, group := range groups {
+			fmt.Fprintf(w, "  %-40s %6d tracks %8d plays\n", groupName(group), group.Count, group.Plays)
+		}
+	}
+
+	writeGroups("top artists", report.TopArtists)
+	writeGroups("top albums", report.TopAlbums)
+	writeGroups("top genres", report.TopGenres)
+	writeGroups("formats", report.Formats)
+	writeGroups("years", report.Years)
+
+	fmt.Fprintf(w, "\nplays per weekday\n")
+	for day, plays := range report.Weekdays {
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-10s %6d %s", time.Weekday(day), plays, bar(plays, report.Weekdays[:])), " "))
+	}
+
+	fmt.Fprintf(w, "\nplays per hour\n")
+	for hour, plays := range report.Hours {
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %02d:00      %6d %s", hour, plays, bar(plays, report.Hours[:])), " "))
+	}
+}
+
+// bar draws n relative to the largest of all values, at most 30 wide
+func bar(n int, all []int) string {
+	max := 0
+	for _, v := range all {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return ""
+	}
+	return strings.Repeat("#", 30*n/max)
+}
+
+// WriteCSV writes the report as csv with the columns section, name, tracks
+// and plays. Columns that do not apply to a section are left empty.
+func WriteCSV(w io.Writer, report Report) error {
+	out := csv.NewWriter(w)
+	itoa := strconv.Itoa
+
+	out.Write([]string{"section", "name", "tracks", "plays"})
+	out.Write([]string{"library", "tracks", itoa(report.Tracks), ""})
+	out.Write([]string{"library", "plays", "", itoa(report.Plays)})
+	out.Write([]string{"library", "never played", itoa(report.NeverPlayed), ""})
+	out.Write([]string{"library", "untagged", itoa(report.Untagged), ""})
+
+	sections := []struct {
+		name   string
+		groups []globals.Group
+	}{
+		{"artist", report.TopArtists},
+		{"album", report.TopAlbums},
+		{"genre", report.TopGenres},
+		{"format", report.Formats},
+		{"year", report.Years},
+	}
+	for _, section := range sections {
+		for _, group := range section.groups {
+			out.Write([]string{section.name, groupName(group), itoa(group.Count), itoa(group.Plays)})
+		}
+	}
+
+	for day, plays := range report.Weekdays {
+		out.Write([]string{"weekday", time.Weekday(day).String(), "", itoa(plays)})
+	}
+	for hour, plays := range report.Hours {
+		out.Write([]string{"hour", itoa(hour), "", itoa(plays)})
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,76 @@
+// Package stats builds reports about the library and how it is listened to,
+// from the tracks and the play history in the database.
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Report holds all statistics. Weekdays start at Sunday and hours are in
+// local time, both count the plays in the history. Database tells whether the
+// database could be reached, when it can not the rest of the report is empty.
+type Report struct {
+	Tracks          int
+	Plays           int
+	NeverPlayed     int
+	Untagged        int
+	UntaggedPercent float64
+	TopArtists      []globals.Group
+	TopAlbums       []globals.Group
+	TopGenres       []globals.Group
+	Formats         []globals.Group
+	Years           []globals.Group
+	Weekdays        [7]int
+	Hours           [24]int
+	Database        globals.Health
+}
+
+// Build gathers the statistics, with the top n artists, albums and genres.
+func Build(ctx context.Context, top int) (Report, error) {
+	var report Report
+
+	totals, err := database.GetTotals(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	report.Tracks = totals.Tracks
+	report.Plays = totals.Plays
+	report.NeverPlayed = totals.NeverPlayed
+	report.Untagged = totals.Untagged
+	if totals.Tracks > 0 {
+		report.UntaggedPercent = 100 * float64(totals.Untagged) / float64(totals.Tracks)
+	}
+
+	if report.TopArtists, err = database.GetTopGroups(ctx, "artist", top); err != nil {
+		return report, err
+	}
+	if report.TopAlbums, err = database.GetTopGroups(ctx, "album", top); err != nil {
+		return report, err
+	}
+	if report.TopGenres, err = database.GetTopGroups(ctx, "genre", top); err != nil {
+		return report, err
+	}
+	if report.Formats, err = database.GetFormatCounts(ctx); err != nil {
+		return report, err
+	}
+	if report.Years, _, err = database.GetGroups(ctx, "year", nil, globals.Page{}); err != nil {
+		return report, err
+	}
+
+	times, err := database.GetPlayTimes(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, played := range times {
+		t := time.Unix(played, 0)
+		report.Weekdays[t.Weekday()]++
+		report.Hours[t.Hour()]++
+	}
+
+	return report, nil
+}
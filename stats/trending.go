@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MeesCode/mmjs/database"
+	"github.com/MeesCode/mmjs/globals"
+)
+
+// Window is a period over which tracks are ranked by their plays. Within
+// the window every play counts for less the older it gets, halving in
+// value every HalfLife. A window without a Length uses the all-time counters.
+type Window struct {
+	Name     string
+	Title    string
+	Length   time.Duration
+	HalfLife time.Duration
+}
+
+const day = 24 * time.Hour
+
+// Windows are the windows that can be chosen, in the order they are cycled through.
+var Windows = []Window{
+	{Name: "week", Title: "this week", Length: 7 * day, HalfLife: 2 * day},
+	{Name: "month", Title: "this month", Length: 30 * day, HalfLife: 7 * day},
+	{Name: "all", Title: "all time"},
+}
+
+// FindWindow returns the window with the given name
+func FindWindow(name string) (Window, bool) {
+	for _, window := range Windows {
+		if window.Name == name {
+			return window, true
+		}
+	}
+	return Window{}, false
+}
+
+// Trending returns the n tracks that were played most within the window,
+// with recent plays weighing more than older ones. Banned tracks are left out.
+func Trending(ctx context.Context, window Window, n int) ([]globals.Track, error) {
+	if window.Length == 0 {
+		return database.GetPopularTracks(ctx, n)
+	}
+
+	now := time.Now()
+	plays, err := database.GetPlaysSince(ctx, now.Add(-window.Length).Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[int]float64)
+	for _, play := range plays {
+		age := now.Sub(time.Unix(play.PlayedAt, 0))
+		scores[play.TrackID] += math.Exp2(-float64(age) / float64(window.HalfLife))
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	banned, err := database.GetBannedTrackIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// tracks that were removed from the library since are skipped, just
+	// like the ones that are banned
+	tracks := make([]globals.Track, 0, n)
+	for _, id := range ids {
+		if len(tracks) == n {
+			break
+		}
+		if banned[id] {
+			continue
+		}
+		track, err := database.GetTrackByID(ctx, id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
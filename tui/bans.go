@@ -0,0 +1,121 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"path"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// the ban list as it is shown in the file list
+var filelistBans = make([]globals.Ban, 0)
+
+// banToDisplayText shows what is banned, tracks by their title instead of their ID
+func banToDisplayText(ban globals.Ban) string {
+	if ban.Kind == "track" {
+		id, _ := strconv.Atoi(ban.Value)
+		if track, err := library.Current.Track(id); err == nil {
+			return "track: " + trackToDisplayText(track)
+		}
+	}
+	return ban.Kind + ": " + ban.Value
+}
+
+// showBans shows the ban list in the file list.
+func showBans() {
+	bans, err := library.Current.Bans()
+	if err != nil {
+		notify("could not get the ban list", err)
+		return
+	}
+
+	index := 0
+	if filelistMode == "bans" {
+		index = myTui.filelist.GetCurrentItem()
+	}
+
+	myTui.filelist.SetTitle(" Banned from the jukebox ")
+	filelistFiles = nil
+	filelistLoader = nil
+	filelistBans = bans
+	myTui.filelist.Clear()
+	for _, ban := range filelistBans {
+		myTui.filelist.AddItem(tview.Escape(banToDisplayText(ban)), "", 0, nil)
+	}
+	filelistMode = "bans"
+	if index >= myTui.filelist.GetItemCount() {
+		index = myTui.filelist.GetItemCount() - 1
+	}
+	if index >= 0 {
+		myTui.filelist.SetCurrentItem(index)
+	}
+	focusWithColor(myTui.filelist)
+}
+
+// openBanDialog lets the user choose whether to ban the track itself or its
+// artist, genre or folder.
+func openBanDialog(track globals.Track) {
+	if myTui.pages.HasPage("ban") {
+		return
+	}
+
+	banlist := myTui.banlist
+	banlist.Clear()
+	add := func(text string, kind string, value string) {
+		banlist.AddItem(tview.Escape(text), "", 0, func() {
+			closeModals()
+			if _, err := library.Current.Ban(kind, value); err != nil {
+				notify("could not ban "+kind+" "+value, err)
+				return
+			}
+			if filelistMode == "bans" {
+				showBans()
+			}
+		})
+	}
+
+	add("this track", "track", strconv.Itoa(track.ID))
+	if track.Artist.Valid {
+		add("artist: "+track.Artist.String, "artist", track.Artist.String)
+	}
+	if track.Genre.Valid {
+		add("genre: "+track.Genre.String, "genre", track.Genre.String)
+	}
+	if folder := path.Dir(track.Path); folder != "/" {
+		add("folder: "+folder, "folder", folder)
+	}
+
+	banlist.SetTitle(" Ban " + tview.Escape(trackToDisplayText(track)) + " ")
+	myTui.pages.AddPage("ban", myTui.banbox, true, true)
+	focusWithColor(banlist)
+}
+
+// handleBanKeys bans the selected track (or its artist, genre or folder) with
+// b and lifts the selected ban with Delete while the ban list is shown.
+// Returns whether the key was handled.
+func handleBanKeys(list *tview.List, event *tcell.EventKey) bool {
+	if list == myTui.filelist && filelistMode == "bans" {
+		index := myTui.filelist.GetCurrentItem()
+		if event.Key() != tcell.KeyDelete || index >= len(filelistBans) {
+			return false
+		}
+		if err := library.Current.Unban(filelistBans[index].ID); err != nil {
+			notify("could not lift ban", err)
+		}
+		showBans()
+		return true
+	}
+
+	if event.Key() != tcell.KeyRune || event.Rune() != 'b' {
+		return false
+	}
+	if track, ok := selectedTrack(list); ok {
+		openBanDialog(track)
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+
+	"github.com/rivo/tview"
+)
+
+// the state of the directory pane when browsing by tag instead of by folder
+var (
+	browseView          = "folders"
+	browseSelection     []globals.Group
+	directorylistGroups = make([]globals.Group, 0)
+)
+
+// groupToDisplayText returns the name of a group followed by the number of tracks in it
+func groupToDisplayText(group globals.Group) string {
+	name := group.Value
+	if name == "" {
+		name = "unknown"
+	} else if group.Tag == "decade" {
+		name += "s"
+	}
+	return name + " (" + strconv.Itoa(group.Count) + ")"
+}
+
+// cycleView switches the directory pane to the next way of browsing:
+// folders, artists, genres and years.
+func cycleView() {
+	for i, view := range library.ViewNames {
+		if view == browseView {
+			browseView = library.ViewNames[(i+1)%len(library.ViewNames)]
+			break
+		}
+	}
+
+	browseSelection = nil
+
+	if browseView == "folders" {
+		myTui.directorylist.SetTitle(" Directories ")
+		root, err := library.Current.Root()
+		if err != nil {
+			notify("could not find the root folder of the library", err)
+			return
+		}
+		directorylistFolders = []globals.Folder{root}
+		myTui.directorylist.SetCurrentItem(0)
+		changedir()
+		return
+	}
+
+	myTui.directorylist.SetTitle(" " + strings.Title(browseView) + " ")
+	browseGroups()
+}
+
+// browseGroups lists the values of the next tag of the current view in the
+// directory pane and the tracks of the current selection in the file list.
+func browseGroups() {
+	levels := library.Views[browseView]
+	depth := len(browseSelection)
+
+	groups := make([]globals.Group, 0)
+	if depth < len(levels) {
+		var err error
+		groups, _, err = library.Current.Groups(levels[depth], browseSelection, globals.Page{})
+		if err != nil {
+			notify("could not browse by "+levels[depth], err)
+			return
+		}
+	}
+
+	// only list tracks once something is selected, not the entire library
+	if depth > 0 {
+		selection := append([]globals.Group(nil), browseSelection...)
+		err := loadTracks(func(page globals.Page) ([]globals.Track, int, error) {
+			return library.Current.Selection(selection, page)
+		})
+		if err != nil {
+			notify("could not find the tracks in the selection", err)
+			return
+		}
+		myTui.filelist.SetTitle(" " + tview.Escape(groupToDisplayText(browseSelection[depth-1])) + " ")
+	}
+
+	directorylistGroups = groups
+	myTui.directorylist.Clear()
+	if depth > 0 {
+		myTui.directorylist.AddItem("..", "", 0, enterGroup)
+	}
+	for _, group := range directorylistGroups {
+		myTui.directorylist.AddItem(tview.Escape(groupToDisplayText(group)), "", 0, enterGroup)
+	}
+}
+
+// selectedGroup returns the group that is selected in the directory pane,
+// false if it is the .. entry.
+func selectedGroup() (globals.Group, bool) {
+	index := myTui.directorylist.GetCurrentItem()
+	if len(browseSelection) > 0 {
+		index--
+	}
+	if index < 0 || index >= len(directorylistGroups) {
+		return globals.Group{}, false
+	}
+	return directorylistGroups[index], true
+}
+
+// enterGroup adds the selected group to the selection, or goes up one level
+// when .. is selected.
+func enterGroup() {
+	group, ok := selectedGroup()
+	if ok {
+		browseSelection = append(browseSelection, group)
+	} else if len(browseSelection) > 0 {
+		browseSelection = browseSelection[:len(browseSelection)-1]
+	}
+	myTui.directorylist.SetCurrentItem(0)
+	browseGroups()
+}
+
+// addGroup adds all tracks of the selected group to the playlist, like
+// adding an entire folder.
+func addGroup() {
+	group, ok := selectedGroup()
+	if !ok {
+		return
+	}
+
+	selection := append(append([]globals.Group{}, browseSelection...), group)
+	tracks, _, err := library.Current.Selection(selection, globals.Page{})
+	if err != nil {
+		notify("could not add "+group.Tag, err)
+		return
+	}
+	audioplayer.Playlist = append(audioplayer.Playlist, tracks...)
+	drawplaylist()
+}
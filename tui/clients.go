@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"strconv"
+
+	"github.com/MeesCode/mmjs/limits"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// the clients of the webserver and web interface as they are shown in the file list
+var filelistClients = make([]limits.Client, 0)
+
+// clientToDisplayText shows the counters of a client
+func clientToDisplayText(client limits.Client) string {
+	text := client.ID + ": " + strconv.Itoa(client.Requests) + " requests, " +
+		strconv.Itoa(client.Refused) + " refused, last seen " + client.LastSeen.Format("15:04:05")
+	if client.Banned() {
+		text += ", banned until " + client.BannedUntil.Format("15:04:05")
+	}
+	if client.Bans > 0 {
+		text += " (" + strconv.Itoa(client.Bans) + " bans)"
+	}
+	return text
+}
+
+// showClients shows the clients of the webserver and web interface in the
+// file list, with how many of their requests were refused by the limits.
+func showClients() {
+	index := 0
+	if filelistMode == "clients" {
+		index = myTui.filelist.GetCurrentItem()
+	}
+
+	myTui.filelist.SetTitle(" Web clients ")
+	filelistFiles = nil
+	filelistLoader = nil
+	filelistClients = limits.Clients()
+	myTui.filelist.Clear()
+	for _, client := range filelistClients {
+		myTui.filelist.AddItem(tview.Escape(clientToDisplayText(client)), "", 0, nil)
+	}
+	filelistMode = "clients"
+	if index >= myTui.filelist.GetItemCount() {
+		index = myTui.filelist.GetItemCount() - 1
+	}
+	if index >= 0 {
+		myTui.filelist.SetCurrentItem(index)
+	}
+	focusWithColor(myTui.filelist)
+}
+
+// handleClientKeys lifts the ban of the selected client with Delete while the
+// clients are shown. Returns whether the key was handled.
+func handleClientKeys(list *tview.List, event *tcell.EventKey) bool {
+	if list != myTui.filelist || filelistMode != "clients" {
+		return false
+	}
+	index := myTui.filelist.GetCurrentItem()
+	if event.Key() != tcell.KeyDelete || index >= len(filelistClients) {
+		return false
+	}
+	limits.Pardon(filelistClients[index].ID)
+	showClients()
+	return true
+}
@@ -3,6 +3,8 @@ package tui
 import (
 	"fmt"
 	"log"
+	"time"
+
 	"github.com/MeesCode/mmjs/globals"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -41,3 +43,37 @@ func DisplayError(err error){
 		log.Fatalln("Could not open database error display")
 	}
 }
+
+// the text of the keybinds box at the bottom, which also shows notifications
+const keybindsText = "F1: help | F2: clear | F3: search | F8: play/pause | F9: previous | F12: next "
+
+// how long a notification stays in the keybinds box
+const notifyTime = 5 * time.Second
+
+// counts the notifications, so only the last one restores the keybinds
+var notifications int
+
+// notify shows an error that does not stop the application, such as a
+// database that can not be reached, in the keybinds box for a few seconds.
+// The error is logged as well. Should be called from the interface goroutine.
+func notify(text string, err error) {
+	log.Println(text, err)
+
+	notifications++
+	current := notifications
+
+	colorFocus := tcell.GetColor("#" + globals.Config.Highlight)
+	myTui.keybinds.SetTitle(" Error ").SetBorderColor(colorFocus)
+	myTui.keybinds.SetText(text + ": " + err.Error())
+
+	go func() {
+		<-time.After(notifyTime)
+		myTui.app.QueueUpdateDraw(func() {
+			if current != notifications {
+				return
+			}
+			myTui.keybinds.SetTitle(" Keybinds ").SetBorderColor(tview.Styles.BorderColor)
+			myTui.keybinds.SetText(keybindsText)
+		})
+	}()
+}
@@ -4,17 +4,15 @@ package tui
 import (
 	"database/sql"
 	"fmt"
-	"os"
 	"path"
 	"strconv"
 	"time"
 	"unicode"
 
 	"github.com/MeesCode/mmjs/audioplayer"
-	"github.com/MeesCode/mmjs/database"
 	"github.com/MeesCode/mmjs/globals"
-
-	"github.com/dhowden/tag"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/stats"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -47,10 +45,36 @@ func stringOrUnknown(s sql.NullString) string {
 	return "unknown"
 }
 
+// markInferred appends a marker to the value when the field was inferred
+// from the path rather than read from the tags.
+func markInferred(track globals.Track, field string, value string) string {
+	if track.IsInferred(field) {
+		return value + " (inferred)"
+	}
+	return value
+}
+
 func updateAudioState() {
 	playtime, totaltime := audioplayer.GetPlaytime()
 	drawprogressbar(playtime, totaltime)
 	updatePlayInfo()
+	updateHealth()
+}
+
+// updateHealth shows in the title of the play info whether the database is
+// offline, and how many plays are waiting to be written to it.
+func updateHealth() {
+	health := library.Current.Health()
+	if health.Online {
+		myTui.infocontainer.SetTitle(" Play Info ")
+		return
+	}
+
+	title := " Play Info [red]database offline"
+	if health.PendingPlays > 0 {
+		title += ", " + strconv.Itoa(health.PendingPlays) + " plays queued"
+	}
+	myTui.infocontainer.SetTitle(title + "[-] ")
 }
 
 // audioStateUpdater is a function that should be ran as a goroutine.
@@ -76,17 +100,18 @@ func updatePlayInfo() {
 // updateInfoBox updates one of the two information boxes with track information
 func updateInfoBox(track globals.Track, box *tview.Table) {
 	dir, name := path.Split(track.Path)
-	box.SetCell(0, 1, tview.NewTableCell(tview.Escape(stringOrUnknown(track.Title))))
-	box.SetCell(1, 1, tview.NewTableCell(tview.Escape(stringOrUnknown(track.Artist))))
-	box.SetCell(2, 1, tview.NewTableCell(tview.Escape(stringOrUnknown(track.Album))))
-	box.SetCell(3, 1, tview.NewTableCell(tview.Escape(stringOrUnknown(track.Genre))))
+	box.SetCell(0, 1, tview.NewTableCell(tview.Escape(markInferred(track, "title", stringOrUnknown(track.Title)))))
+	box.SetCell(1, 1, tview.NewTableCell(tview.Escape(markInferred(track, "artist", stringOrUnknown(track.Artist)))))
+	box.SetCell(2, 1, tview.NewTableCell(tview.Escape(markInferred(track, "album", stringOrUnknown(track.Album)))))
+	box.SetCell(3, 1, tview.NewTableCell(tview.Escape(markInferred(track, "genre", stringOrUnknown(track.Genre)))))
 	if track.Year.Valid {
-		box.SetCell(4, 1, tview.NewTableCell(strconv.FormatInt(track.Year.Int64, 10)))
+		box.SetCell(4, 1, tview.NewTableCell(markInferred(track, "year", strconv.FormatInt(track.Year.Int64, 10))))
 	} else {
 		box.SetCell(4, 1, tview.NewTableCell("unknown"))
 	}
 	box.SetCell(5, 1, tview.NewTableCell(tview.Escape(name)))
 	box.SetCell(6, 1, tview.NewTableCell(tview.Escape(dir)))
+	box.SetCell(7, 1, tview.NewTableCell(ratingToDisplayText(track)))
 }
 
 // convert hex value encoded in an int to rgb notation
@@ -121,6 +146,8 @@ func drawplaylist() {
 // drawfilelist draws the file list. This function should be called after every
 // function that alters this list.
 func drawfilelist() {
+	filelistMode = "tracks"
+	filelistLoader, filelistTotal = nil, 0
 	myTui.filelist.Clear()
 	for _, track := range filelistFiles {
 		myTui.filelist.AddItem(tview.Escape(trackToDisplayText(track)), "", 0, addsong)
@@ -129,12 +156,35 @@ func drawfilelist() {
 
 // drawfilelistWithPlays draws the file list. Will add a playcounter.
 func drawfilelistWithPlays() {
+	filelistMode = "tracks"
+	filelistLoader, filelistTotal = nil, 0
 	myTui.filelist.Clear()
 	for _, track := range filelistFiles {
 		myTui.filelist.AddItem(tview.Escape("("+strconv.Itoa(track.Plays)+") "+trackToDisplayText(track)), "", 0, addsong)
 	}
 }
 
+// redrawTracks draws the file list and the playlist again after tracks in them
+// changed, without leaving the current view of the file list.
+func redrawTracks() {
+	mode := filelistMode
+	loader, total := filelistLoader, filelistTotal
+	index := myTui.filelist.GetCurrentItem()
+	switch mode {
+	case "playlists", "bans", "clients":
+	case "popular":
+		drawfilelistWithPlays()
+	default:
+		drawfilelist()
+	}
+	filelistMode = mode
+	filelistLoader, filelistTotal = loader, total
+	if index < myTui.filelist.GetItemCount() {
+		myTui.filelist.SetCurrentItem(index)
+	}
+	drawplaylist()
+}
+
 // drawdirectorylist draws the directory list. This function should be called after every
 // function that alters this list.
 func drawdirectorylist(parentFunc func(), isRoot bool) {
@@ -188,6 +238,7 @@ func drawprogressbar(playtime time.Duration, length time.Duration) {
 // openSearch removes the keybinds box and replaces it with the search box.
 func openSearch() {
 	myTui.pages.AddPage("search", myTui.searchbox, true, true)
+	myTui.searchinput.SetTitle(" Search ")
 	myTui.searchinput.SetText("")
 	focusWithColor(myTui.searchinput)
 }
@@ -197,10 +248,20 @@ func finishSearch() {
 	myTui.filelist.SetTitle(" Search results ")
 	myTui.pages.RemovePage("search")
 	focusWithColor(myTui.filelist)
-	drawfilelist()
 }
 
 func clearplaylist() {
+	openConfirm("Are you sure you want to \nclear the playlist?", func() {
+		audioplayer.Clear()
+		drawplaylist()
+	})
+}
+
+// openConfirm asks the user to confirm the text, action is only run when
+// the user does.
+func openConfirm(text string, action func()) {
+	confirmAction = action
+	myTui.confirmtext.SetText(text)
 	myTui.pages.AddPage("confirm", myTui.confirmbox, true, true)
 	focusWithColor(myTui.confirmcontent)
 	myTui.app.SetFocus(myTui.confirmfalse)
@@ -212,10 +273,25 @@ func openKeybinds() {
 	focusWithColor(myTui.keybindstext)
 }
 
+// openStats opens a dialog with the statistics of the library
+func openStats() {
+	report, err := library.Current.Stats(10)
+	if err != nil {
+		notify("could not build statistics", err)
+		return
+	}
+	myTui.statstext.Clear()
+	stats.WriteText(myTui.statstext, report)
+	myTui.statstext.ScrollToBeginning()
+	myTui.pages.AddPage("stats", myTui.statsbox, true, true)
+	focusWithColor(myTui.statstext)
+}
+
 // jump to a new element in the list depending on the key pressed.
 func jump(r rune) {
-	for index, folder := range directorylistFolders {
-		if unicode.ToLower(rune(path.Base(folder.Path)[0])) == unicode.ToLower(r) {
+	for index := 0; index < myTui.directorylist.GetItemCount(); index++ {
+		name, _ := myTui.directorylist.GetItemText(index)
+		if name != "" && unicode.ToLower([]rune(name)[0]) == unicode.ToLower(r) {
 			myTui.directorylist.SetCurrentItem(index)
 			return
 		}
@@ -224,9 +300,10 @@ func jump(r rune) {
 
 // closeModals closes all the modals on the screen and moves the cursor
 func closeModals() {
-	var modals = [4]string{"search", "playlist", "keybinds", "confirm"}
+	var modals = [7]string{"search", "playlist", "keybinds", "confirm", "stats", "tags", "ban"}
 	for _, i := range modals {
 		if myTui.pages.HasPage(i) {
+			confirmAction = nil
 			myTui.pages.RemovePage(i)
 			focusWithColor(myTui.directorylist)
 			return
@@ -236,49 +313,17 @@ func closeModals() {
 
 // goback selects the top item in the directory list and enters it.
 func goback() {
+	if browseView != "folders" {
+		if len(browseSelection) > 0 {
+			myTui.directorylist.SetCurrentItem(0)
+			enterGroup()
+		}
+		return
+	}
 	myTui.directorylist.SetCurrentItem(0)
 	changedir()
 }
 
-// parseTrack takes a path to a playable file, extracts the metadata and returns a file
-// object containing this metadata. The metadata might not be found and defaulted to nil.
-func parseTrack(file string) globals.Track {
-	f, _ := os.Open(path.Join(globals.Root, file))
-	m, err := tag.ReadFrom(f)
-
-	var track globals.Track
-
-	// relative path
-	rpath := path.Clean(file[len(globals.Root):])
-
-	_, filename := path.Split(file)
-
-	// if no tags were found default to nil
-	if err != nil {
-		track = globals.Track{
-			ID:       -1,
-			Path:     rpath,
-			FolderID: -1,
-			Title:    sql.NullString{String: filename, Valid: true},
-			Album:    sql.NullString{String: "", Valid: false},
-			Artist:   sql.NullString{String: "", Valid: false},
-			Genre:    sql.NullString{String: "", Valid: false},
-			Year:     sql.NullInt64{Int64: -1, Valid: false}}
-	} else {
-		track = globals.Track{
-			ID:       -1,
-			Path:     rpath,
-			FolderID: -1,
-			Title:    database.StringToSQLNullableString(m.Title()),
-			Artist:   database.StringToSQLNullableString(m.Artist()),
-			Album:    database.StringToSQLNullableString(m.Album()),
-			Genre:    database.StringToSQLNullableString(m.Genre()),
-			Year:     database.IntToSQLNullableInt(m.Year())}
-	}
-
-	return track
-}
-
 func focusWithColor(primitive tview.Primitive) {
 	myTui.directorylist.SetBorderColor(colorUnfocus)
 	myTui.filelist.SetBorderColor(colorUnfocus)
@@ -307,6 +352,11 @@ func focusWithColor(primitive tview.Primitive) {
 		flex.SetBorderColor(colorFocus)
 	}
 
+	form, ok := primitive.(*tview.Form)
+	if ok {
+		form.SetBorderColor(colorFocus)
+	}
+
 	myTui.app.SetFocus(primitive)
 }
 
@@ -349,7 +399,7 @@ func insertsong() {
 	filelistIndex := myTui.filelist.GetCurrentItem()
 
 	// playlists don't support insertion
-	if filelistFiles[filelistIndex].Path == "not applicable" {
+	if filelistIndex >= len(filelistFiles) {
 		return
 	}
 
@@ -6,8 +6,8 @@ import (
 	"log"
 
 	"github.com/MeesCode/mmjs/audioplayer"
-	"github.com/MeesCode/mmjs/database"
 	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -16,12 +16,12 @@ import (
 // global variables
 var (
 	filelistFiles        = make([]globals.Track, 0)
+	filelistPlaylists    = make([]globals.Playlist, 0)
+	filelistMode         = "tracks"
+	confirmAction        func()
+	inputAction          func(text string)
 	directorylistFolders = make([]globals.Folder, 0)
 	myTui                tui
-	changedir            func()
-	search               func()
-	searchQuery          func(string)
-	addFolder            func()
 )
 
 var (
@@ -38,6 +38,7 @@ type tui struct {
 	filelist       *tview.List
 	playlist       *tview.List
 	infobox        *tview.Table
+	infocontainer  *tview.Flex
 	browseinfobox  *tview.Table
 	progressbar    *tview.TextView
 	playtime       *tview.TextView
@@ -49,10 +50,17 @@ type tui struct {
 	confirmbox     *tview.Flex
 	confirmfalse   *tview.Button
 	confirmcontent *tview.Flex
+	confirmtext    *tview.TextView
 	playlistinput  *tview.InputField
 	playlistbox    *tview.Flex
 	keybindstext   *tview.TextView
 	keybindsbox    *tview.Flex
+	statstext      *tview.TextView
+	statsbox       *tview.Flex
+	tagform        *tview.Form
+	tagbox         *tview.Flex
+	banlist        *tview.List
+	banbox         *tview.Flex
 }
 
 // Start builds the user interface, defines the keybinds and sets initial values.
@@ -87,6 +95,7 @@ func Start() {
 	infobox.SetCell(4, 0, tview.NewTableCell("Year"))
 	infobox.SetCell(5, 0, tview.NewTableCell("Filename"))
 	infobox.SetCell(6, 0, tview.NewTableCell("Directory"))
+	infobox.SetCell(7, 0, tview.NewTableCell("Rating"))
 
 	browseinfobox := tview.NewTable()
 	browseinfobox.SetBackgroundColor(tcell.ColorDefault)
@@ -98,6 +107,7 @@ func Start() {
 	browseinfobox.SetCell(4, 0, tview.NewTableCell("Year"))
 	browseinfobox.SetCell(5, 0, tview.NewTableCell("Filename"))
 	browseinfobox.SetCell(6, 0, tview.NewTableCell("Directory"))
+	browseinfobox.SetCell(7, 0, tview.NewTableCell("Rating"))
 
 	infoboxcontainer := tview.NewFlex()
 	infoboxcontainer.SetBackgroundColor(tcell.ColorDefault)
@@ -117,12 +127,12 @@ func Start() {
 	keybinds.SetBorder(true).SetTitle(" Keybinds ")
 	keybinds.SetBackgroundColor(tcell.ColorDefault)
 	keybinds.SetTextAlign(1)
-	fmt.Fprintf(keybinds, "F1: help | F2: clear | F3: search | F8: play/pause | F9: previous | F12: next ")
+	fmt.Fprintf(keybinds, keybindsText)
 
 	searchinput := tview.NewInputField().
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
-				search()
+				searchLibrary()
 			}
 		})
 	searchinput.SetBackgroundColor(tcell.ColorDefault)
@@ -141,7 +151,6 @@ func Start() {
 
 	confirmtext := tview.NewTextView()
 	confirmtext.SetBackgroundColor(tcell.ColorDefault)
-	fmt.Fprintf(confirmtext, "Are you sure you want to \ndelete the playlist?")
 
 	confirmcontent := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(confirmtext, 3, 1, false).
@@ -167,7 +176,7 @@ func Start() {
 F1:  show all
 F2:  clear
 F3:  search
-F4:  popular
+F4:  popular (again: week/month/all time)
 F5:  shuffle
 F6:  show playlists
 F7:  save playlist
@@ -177,6 +186,9 @@ F10: random
 F12: next
 >:   seek forward
 <:   seek backward
+Ctrl+S: statistics
+Ctrl+B: show ban list
+Ctrl+W: show web clients
 
 [terminal]
 F11:    toggle fullscreen
@@ -189,15 +201,48 @@ Enter:     play selected track
 Delete:    remove selected track
 plus (+):  move track down
 minus (-): move track up
+m:         more like this
 
 [directories]
 Enter:     enter folder
 Alt+Enter: add entire folder
 Backspace: previous folder
+Ctrl+T:    browse by folder/artist/genre/year
 
 [file selection]
 Enter:  add track
 Intert: add as next track
+p:      add track to last edited playlist
+m:      more like this
+T:      edit tags of all listed tracks
+
+[file selection and playlist]
+1-5: rate track
+0:   remove rating
+*:   toggle favourite
+t:   edit tags
+b:   ban track, artist, genre or folder
+
+[playlists (F6)]
+Enter:  load playlist
+e:      edit playlist (or the rules of a smart one)
+n:      new smart playlist
+r:      rename playlist
+a:      append queue to playlist
+o:      overwrite playlist with queue
+Delete: delete playlist
+
+[ban list (Ctrl+B)]
+Delete: lift ban
+
+[web clients (Ctrl+W)]
+Delete: lift ban of client
+
+[editing a playlist]
+Delete:    remove selected track
+plus (+):  move track down
+minus (-): move track up
+Backspace: back to playlists
 
 [contextual]
 Esc: go back`)
@@ -210,9 +255,11 @@ F3:  search
 F5:  shuffle
 F8:  play/pause
 F9:  previous
+F10: random
 F12: next
 >:   seek forward
 <:   seek backward
+Ctrl+W: show web clients
 
 [terminal]
 F11:    toggle fullscreen
@@ -225,15 +272,21 @@ Enter:     play selected track
 Delete:    remove selected track
 plus (+):  move track down
 minus (-): move track up
+m:         more like this
 
 [directories]
 Enter:     enter folder
 Alt+Enter: add entire folder
 Backspace: previous folder
+Ctrl+T:    browse by folder/artist/genre/year
 
 [file selection]
 Enter:  add track
 Intert: add as next track
+m:      more like this
+
+[web clients (Ctrl+W)]
+Delete: lift ban of client
 
 [contextual]
 Esc: go back`)
@@ -243,16 +296,54 @@ Esc: go back`)
 		AddItem(nil, 0, 1, false).
 		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 			AddItem(nil, 0, 1, false).
-			AddItem(keybindstext, 38, 1, false).
+			AddItem(keybindstext, 0, 10, false).
 			AddItem(nil, 0, 1, false), 50, 1, false).
 		AddItem(nil, 0, 1, false)
 	keybindstext.SetBackgroundColor(tcell.ColorDefault)
 	keybindstext.SetBorder(true).SetTitle(" All keybindings ")
 
+	statstext := tview.NewTextView()
+	statstext.SetBackgroundColor(tcell.ColorDefault)
+	statstext.SetBorder(true).SetTitle(" Statistics ")
+
+	statsbox := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(statstext, 0, 10, false).
+			AddItem(nil, 0, 1, false), 80, 1, false).
+		AddItem(nil, 0, 1, false)
+
+	tagform := tview.NewForm()
+	tagform.SetBackgroundColor(tcell.ColorDefault)
+	tagform.SetFieldBackgroundColor(tcell.ColorGray)
+	tagform.SetButtonBackgroundColor(tcell.ColorGray)
+	tagform.SetBorder(true).SetTitle(" Edit tags ")
+
+	tagbox := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(tagform, 17, 1, false).
+			AddItem(nil, 0, 1, false), 60, 1, false).
+		AddItem(nil, 0, 1, false)
+
+	banlist := tview.NewList().ShowSecondaryText(false)
+	banlist.SetBackgroundColor(tcell.ColorDefault)
+	banlist.SetBorder(true).SetTitle(" Ban ")
+
+	banbox := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(banlist, 6, 1, false).
+			AddItem(nil, 0, 1, false), 60, 1, false).
+		AddItem(nil, 0, 1, false)
+
 	playlistinput := tview.NewInputField().
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
-				savePlaylist()
+				finishPlaylistInput()
 			}
 		})
 	playlistinput.SetBackgroundColor(tcell.ColorDefault)
@@ -279,6 +370,7 @@ Esc: go back`)
 		if len(filelistFiles) > 0 {
 			updateInfoBox(filelistFiles[i], browseinfobox)
 		}
+		loadMore(i)
 	})
 
 	playlist := tview.NewList()
@@ -292,14 +384,14 @@ Esc: go back`)
 			AddItem(directorylist, 0, 1, false).
 			AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 				AddItem(filelist, 0, 1, false).
-				AddItem(browseinfobox, 9, 0, false), 0, 1, false).
+				AddItem(browseinfobox, 10, 0, false), 0, 1, false).
 			AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
 				AddItem(infoboxcontainer.
 					AddItem(infobox, 0, 1, false).
 					AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
 						AddItem(playtime, 9, 0, false).
 						AddItem(progressbar, 0, 1, false).
-						AddItem(totaltime, 9, 0, false), 1, 0, false), 11, 0, false).
+						AddItem(totaltime, 9, 0, false), 1, 0, false), 12, 0, false).
 				AddItem(playlist, 0, 1, false), 0, 1, false), 0, 1, false).
 		AddItem(keybinds, 3, 0, false)
 
@@ -314,6 +406,7 @@ Esc: go back`)
 		filelist:       filelist,
 		playlist:       playlist,
 		infobox:        infobox,
+		infocontainer:  infoboxcontainer,
 		progressbar:    progressbar,
 		playtime:       playtime,
 		totaltime:      totaltime,
@@ -325,30 +418,23 @@ Esc: go back`)
 		confirmbox:     confirmbox,
 		confirmfalse:   confirmfalse,
 		confirmcontent: confirmcontent,
+		confirmtext:    confirmtext,
 		playlistbox:    playlistbox,
 		playlistinput:  playlistinput,
 		keybindsbox:    keybindsbox,
 		keybindstext:   keybindstext,
+		statstext:      statstext,
+		statsbox:       statsbox,
+		tagform:        tagform,
+		tagbox:         tagbox,
+		banlist:        banlist,
+		banbox:         banbox,
 	}
 
-	// do some stuff depending on if we are in database or filesystem mode
-	// and set the root folder as the current
-	var folder globals.Folder
-	if globals.Config.Mode == "filesystem" {
-		addFolder = addFolderFilesystem
-		changedir = changedirFilesystem
-		search = searchFilesystem
-		searchQuery = searchFilesystemQuery
-		folder = globals.Folder{
-			ID:       -1,
-			Path:     globals.Root,
-			ParentID: -1}
-	} else {
-		addFolder = addFolderDatabase
-		changedir = changedirDatabase
-		search = searchDatabase
-		searchQuery = searchDatabaseQuery
-		folder = database.GetFolderByID(1)
+	// set the root folder as the current
+	folder, err := library.Current.Root()
+	if err != nil {
+		log.Fatalln("Could not find the root folder of the library", err)
 	}
 
 	directorylistFolders = append(directorylistFolders, folder)
@@ -385,15 +471,26 @@ Esc: go back`)
 				getPopular()
 				focusWithColor(filelist)
 				return nil
-			case tcell.KeyF10:
+			case tcell.KeyCtrlB:
 				if !myTui.main.HasFocus() { return nil }
-				getRandom()
-				focusWithColor(filelist)
+				showBans()
+				return nil
+			case tcell.KeyCtrlS:
+				if pages.HasPage("stats") {
+					closeModals()
+				} else {
+					if !myTui.main.HasFocus() { return nil }
+					openStats()
+				}
 				return nil
 			}
 		}
 
 		switch event.Key() {
+		case tcell.KeyCtrlW:
+			if !myTui.main.HasFocus() { return nil }
+			showClients()
+			return nil
 		case tcell.KeyF1:
 			if pages.HasPage("keybinds") {
 				closeModals()
@@ -435,6 +532,11 @@ Esc: go back`)
 		case tcell.KeyF9:
 			previoussong()
 			return nil
+		case tcell.KeyF10:
+			if !myTui.main.HasFocus() { return nil }
+			getRandom()
+			focusWithColor(filelist)
+			return nil
 		case tcell.KeyF12:
 			nextsong()
 			return nil
@@ -446,6 +548,10 @@ Esc: go back`)
 			closeModals()
 			return nil
 		case tcell.KeyRune:
+			// typing in dialogs such as the search, where year:<1990 is allowed
+			if !myTui.main.HasFocus() {
+				return event
+			}
 			if event.Rune() == '>' {
 				seekforward()
 				return nil
@@ -460,6 +566,15 @@ Esc: go back`)
 
 	// file list
 	filelist.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if handlePlaylistKeys(event) || handleClientKeys(filelist, event) || handleBanKeys(filelist, event) || handleRatingKeys(filelist, event) || handleTagKeys(filelist, event) {
+			return nil
+		}
+
+		if event.Key() == tcell.KeyRune && event.Rune() == 'm' {
+			showSimilar(filelist)
+			return nil
+		}
+
 		switch event.Key() {
 		case tcell.KeyInsert:
 			insertsong()
@@ -476,6 +591,15 @@ Esc: go back`)
 
 	// playlist
 	playlist.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if handleRatingKeys(playlist, event) || handleTagKeys(playlist, event) || handleBanKeys(playlist, event) {
+			return nil
+		}
+
+		if event.Key() == tcell.KeyRune && event.Rune() == 'm' {
+			showSimilar(playlist)
+			return nil
+		}
+
 		switch event.Key() {
 		case tcell.KeyTab:
 			focusWithColor(directorylist)
@@ -488,7 +612,7 @@ Esc: go back`)
 			return nil
 		case tcell.KeyLeft, tcell.KeyBacktab:
 			focusWithColor(filelist)
-			if myTui.filelist.GetItemCount() > 0 {
+			if myTui.filelist.GetCurrentItem() < len(filelistFiles) {
 				updateInfoBox(filelistFiles[myTui.filelist.GetCurrentItem()], browseinfobox)
 			}
 			return nil
@@ -511,17 +635,24 @@ Esc: go back`)
 		// alt-enter is the only key combination in this system
 		// it's only here for legacy reasons
 		if event.Key() == tcell.KeyEnter && event.Modifiers() == tcell.ModAlt {
-			addFolder()
+			if browseView == "folders" {
+				addFolder()
+			} else {
+				addGroup()
+			}
 			return nil
 		}
 
 		switch event.Key() {
+		case tcell.KeyCtrlT:
+			cycleView()
+			return nil
 		case tcell.KeyRune:
 			jump(event.Rune())
 			return nil
 		case tcell.KeyRight, tcell.KeyTab:
 			focusWithColor(filelist)
-			if myTui.filelist.GetItemCount() > 0 {
+			if myTui.filelist.GetCurrentItem() < len(filelistFiles) {
 				updateInfoBox(filelistFiles[myTui.filelist.GetCurrentItem()], browseinfobox)
 			}
 			return nil
@@ -553,9 +684,11 @@ Esc: go back`)
 			myTui.app.SetFocus(confirmfalse)
 			return nil
 		case tcell.KeyEnter:
-			audioplayer.Clear()
+			action := confirmAction
 			closeModals()
-			drawplaylist()
+			if action != nil {
+				action()
+			}
 			return nil
 		}
 		return event
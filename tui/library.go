@@ -0,0 +1,141 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"errors"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/search"
+	"github.com/MeesCode/mmjs/stats"
+
+	"github.com/rivo/tview"
+)
+
+// changedir changes the current directory to the one that is selected.
+func changedir() {
+	var base = directorylistFolders[myTui.directorylist.GetCurrentItem()]
+
+	folders, _, err := library.Current.Folders(base, globals.Page{})
+	if err != nil {
+		notify("could not find directory to change into", err)
+		return
+	}
+
+	// only add parent folder when we are not in the root directory
+	var isRoot = library.IsRoot(base)
+	var parents []globals.Folder
+	if !isRoot {
+		parent, err := library.Current.Parent(base)
+		if err != nil {
+			notify("could not find parent directory", err)
+			return
+		}
+		parents = []globals.Folder{parent}
+	}
+
+	// large folders are loaded while scrolling through them
+	err = loadTracks(func(page globals.Page) ([]globals.Track, int, error) {
+		return library.Current.Tracks(base, page)
+	})
+	if err != nil {
+		notify("could not find directory to change into", err)
+		return
+	}
+	myTui.filelist.SetTitle(" Current directory ")
+
+	//add the rest of the folders
+	directorylistFolders = append(parents, folders...)
+
+	drawdirectorylist(changedir, isRoot)
+}
+
+// the window of stats.Windows the popular tracks are shown for
+var popularWindow = 0
+
+// get 100 most popular tracks, asking again while they are shown
+// switches to the next window (this week, this month, all time)
+func getPopular() {
+	if filelistMode == "popular" {
+		popularWindow = (popularWindow + 1) % len(stats.Windows)
+	}
+	window := stats.Windows[popularWindow]
+
+	tracks, err := library.Current.Popular(window.Name, 100)
+	if err != nil {
+		notify("could not get popular tracks", err)
+		return
+	}
+	filelistFiles = tracks
+	myTui.filelist.SetTitle(" Popular tracks (" + window.Title + ") ")
+	drawfilelistWithPlays()
+	filelistMode = "popular"
+}
+
+// get 100 random tracks
+func getRandom() {
+	tracks, err := library.Current.Random(100)
+	if err != nil {
+		notify("could not get random tracks", err)
+		return
+	}
+	filelistFiles = tracks
+	myTui.filelist.SetTitle(" Random tracks ")
+	drawfilelist()
+}
+
+// showSimilar shows the tracks that are most like the selected track of the
+// file list or the playlist.
+func showSimilar(list *tview.List) {
+	track, ok := selectedTrack(list)
+	if !ok {
+		return
+	}
+
+	tracks, err := library.Current.Similar(track.ID, 50)
+	if err != nil {
+		notify("could not find similar tracks", err)
+		return
+	}
+	filelistFiles = tracks
+	myTui.filelist.SetTitle(" More like " + tview.Escape(trackToDisplayText(track)) + " ")
+	drawfilelist()
+	myTui.filelist.SetCurrentItem(0)
+	focusWithColor(myTui.filelist)
+}
+
+// searchLibrary shows the tracks that best match the text that is currently entered
+// in the searchbox, best match first.
+func searchLibrary() {
+	var term = myTui.searchinput.GetText()
+	err := loadTracks(func(page globals.Page) ([]globals.Track, int, error) {
+		return library.Current.Search(term, page)
+	})
+
+	// explain what is wrong with the query and let the user fix it
+	var syntaxErr *search.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		myTui.searchinput.SetTitle(" " + tview.Escape(syntaxErr.Error()) + " ")
+		return
+	}
+
+	if err != nil {
+		notify("could not perform search", err)
+		filelistFiles = nil
+		drawfilelist()
+	}
+	finishSearch()
+}
+
+// addFolder adds all tracks inside the currently selected folder to the playlist.
+// This includes all tracks inside child folders.
+func addFolder() {
+	tracks, err := library.Current.AllTracks(directorylistFolders[myTui.directorylist.GetCurrentItem()])
+	if err != nil {
+		notify("could not add folder", err)
+		return
+	}
+	audioplayer.Playlist = append(audioplayer.Playlist, tracks...)
+	drawplaylist()
+}
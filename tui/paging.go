@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"github.com/MeesCode/mmjs/globals"
+
+	"github.com/rivo/tview"
+)
+
+// the number of tracks that are loaded into the file list at a time
+const filelistPageSize = 200
+
+// filelistLoader loads another page of the tracks that are shown in the file
+// list, it is nil once every track is loaded.
+var (
+	filelistLoader func(page globals.Page) ([]globals.Track, int, error)
+	filelistTotal  int
+)
+
+// loadTracks shows the first page of tracks in the file list, the rest is
+// loaded while scrolling through it. Nothing changes when there is an error.
+func loadTracks(load func(page globals.Page) ([]globals.Track, int, error)) error {
+	tracks, total, err := load(globals.Page{Limit: filelistPageSize})
+	if err != nil {
+		return err
+	}
+
+	filelistFiles = tracks
+	drawfilelist()
+	if len(tracks) < total {
+		filelistLoader = load
+		filelistTotal = total
+	}
+	return nil
+}
+
+// loadMore loads the next page when the selected item of the file list comes
+// close to the end of the tracks that are loaded.
+func loadMore(index int) {
+	if filelistLoader == nil || index < len(filelistFiles)-filelistPageSize/4 {
+		return
+	}
+
+	tracks, total, err := filelistLoader(globals.Page{Offset: len(filelistFiles), Limit: filelistPageSize})
+	if err != nil {
+		filelistLoader = nil
+		notify("could not load more tracks", err)
+		return
+	}
+
+	filelistFiles = append(filelistFiles, tracks...)
+	for _, track := range tracks {
+		myTui.filelist.AddItem(tview.Escape(trackToDisplayText(track)), "", 0, addsong)
+	}
+
+	// the list may have become shorter since the first page
+	if len(tracks) == 0 {
+		total = len(filelistFiles)
+	}
+	filelistTotal = total
+	if len(filelistFiles) >= filelistTotal {
+		filelistLoader = nil
+	}
+}
+
+// loadAll loads the tracks of the file list that are not loaded yet, for
+// actions on every track in it. Returns false when that failed.
+func loadAll() bool {
+	for filelistLoader != nil {
+		loadMore(len(filelistFiles))
+	}
+	return len(filelistFiles) >= filelistTotal
+}
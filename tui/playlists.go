@@ -0,0 +1,278 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/search"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// the playlist that is being edited, or was edited last. tracks can be
+// added to it from any file list.
+var editingPlaylist globals.Playlist
+
+// openPlaylistInput opens the dialog to enter the name of a new playlist.
+func openPlaylistInput() {
+	openInput(" Name for new playlist ", "", func(name string) {
+		_, err := library.Current.SavePlaylist(name, audioplayer.Playlist)
+		if !showPlaylistError(err) {
+			showPlaylists()
+		}
+	})
+}
+
+// openInput opens the input dialog with a title and initial text, action is
+// called with the entered text when the user presses enter.
+func openInput(title string, text string, action func(text string)) {
+	if myTui.pages.HasPage("search") || myTui.pages.HasPage("playlist") || myTui.pages.HasPage("keybinds") {
+		return
+	}
+	inputAction = action
+	myTui.pages.AddPage("playlist", myTui.playlistbox, true, true)
+	myTui.playlistinput.SetTitle(title)
+	myTui.playlistinput.SetText(text)
+	focusWithColor(myTui.playlistinput)
+}
+
+// finishPlaylistInput runs the action of the input dialog. The dialog is
+// closed first, so the action can keep it open by reopening it.
+func finishPlaylistInput() {
+	var name = myTui.playlistinput.GetText()
+	var action = inputAction
+	myTui.pages.RemovePage("playlist")
+	focusWithColor(myTui.filelist)
+	if name == "" || action == nil {
+		return
+	}
+	action(name)
+}
+
+// showPlaylistError shows what went wrong with a playlist operation. When the
+// name was taken the input dialog is opened again so the user can pick another.
+// Returns whether there was an error.
+func showPlaylistError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, library.ErrPlaylistExists) {
+		var action = inputAction
+		openInput(" Name already taken, choose another ", myTui.playlistinput.GetText(), action)
+		return true
+	}
+	var syntaxErr *search.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		var action = inputAction
+		openInput(" "+tview.Escape(syntaxErr.Error())+" ", myTui.playlistinput.GetText(), action)
+		return true
+	}
+	notify("playlist operation failed", err)
+	return true
+}
+
+// openSmartPlaylistInput asks for the rules of a new smart playlist and then for its name.
+func openSmartPlaylistInput() {
+	openInput(" Rules, e.g. genre:metal year:<1990 sort:-plays limit:50 ", "", func(rules string) {
+		if err := library.CheckRules(rules); showPlaylistError(err) {
+			return
+		}
+		openInput(" Name for new smart playlist ", "", func(name string) {
+			_, err := library.Current.SaveSmartPlaylist(name, rules)
+			if !showPlaylistError(err) {
+				showPlaylists()
+			}
+		})
+	})
+}
+
+// selectedPlaylist returns the playlist under the cursor when the playlists are shown.
+func selectedPlaylist() (globals.Playlist, bool) {
+	index := myTui.filelist.GetCurrentItem()
+	if filelistMode != "playlists" || index >= len(filelistPlaylists) {
+		return globals.Playlist{}, false
+	}
+	return filelistPlaylists[index], true
+}
+
+// insertPlaylist replaces the queue with the selected playlist.
+func insertPlaylist() {
+	pl, ok := selectedPlaylist()
+	if !ok {
+		return
+	}
+	tracks, _, err := library.Current.PlaylistTracks(pl.ID, globals.Page{})
+	if err != nil {
+		notify("could not load playlist", err)
+		return
+	}
+	audioplayer.Clear()
+	audioplayer.Songindex = 0
+	audioplayer.Playlist = tracks
+	drawplaylist()
+}
+
+// showPlaylists shows all saved playlists in the file list.
+func showPlaylists() {
+	playlists, err := library.Current.Playlists()
+	if err != nil {
+		notify("could not get playlists", err)
+		return
+	}
+
+	index := 0
+	if filelistMode == "playlists" {
+		index = myTui.filelist.GetCurrentItem()
+	}
+
+	myTui.filelist.SetTitle(" Playlists ")
+	filelistFiles = nil
+	filelistLoader = nil
+	filelistPlaylists = playlists
+	myTui.filelist.Clear()
+	for _, playlist := range filelistPlaylists {
+		if playlist.IsSmart() {
+			myTui.filelist.AddItem(tview.Escape(playlist.Name+" (smart)"), "", 0, insertPlaylist)
+		} else {
+			myTui.filelist.AddItem(tview.Escape(playlist.Name+" ("+strconv.Itoa(playlist.Tracks)+")"), "", 0, insertPlaylist)
+		}
+		if playlist.ID == editingPlaylist.ID && filelistMode != "playlists" {
+			index = myTui.filelist.GetItemCount() - 1
+		}
+	}
+	filelistMode = "playlists"
+	if index < myTui.filelist.GetItemCount() {
+		myTui.filelist.SetCurrentItem(index)
+	}
+	focusWithColor(myTui.filelist)
+}
+
+// editPlaylist shows the tracks in a playlist so they can be removed or moved.
+func editPlaylist(playlist globals.Playlist) {
+	tracks, _, err := library.Current.PlaylistTracks(playlist.ID, globals.Page{})
+	if err != nil {
+		notify("could not load playlist", err)
+		return
+	}
+
+	index := 0
+	if filelistMode == "entries" && editingPlaylist.ID == playlist.ID {
+		index = myTui.filelist.GetCurrentItem()
+	}
+
+	editingPlaylist = playlist
+	filelistFiles = tracks
+	myTui.filelist.SetTitle(" Editing " + tview.Escape(playlist.Name) + " ")
+	drawfilelist()
+	filelistMode = "entries"
+
+	if index >= myTui.filelist.GetItemCount() {
+		index = myTui.filelist.GetItemCount() - 1
+	}
+	if index >= 0 {
+		myTui.filelist.SetCurrentItem(index)
+	}
+}
+
+// moveEntry moves the selected track in the playlist being edited by offset places.
+func moveEntry(offset int) {
+	index := myTui.filelist.GetCurrentItem()
+	if index+offset < 0 || index+offset >= len(filelistFiles) {
+		return
+	}
+	err := library.Current.MovePlaylistEntry(editingPlaylist.ID, index, index+offset)
+	if showPlaylistError(err) {
+		return
+	}
+	editPlaylist(editingPlaylist)
+	myTui.filelist.SetCurrentItem(index + offset)
+}
+
+// handlePlaylistKeys handles the keys of the playlist manager in the file list.
+// Returns whether the key was handled.
+func handlePlaylistKeys(event *tcell.EventKey) bool {
+	switch filelistMode {
+	case "playlists":
+		if event.Key() == tcell.KeyRune && event.Rune() == 'n' {
+			openSmartPlaylistInput()
+			return true
+		}
+
+		pl, ok := selectedPlaylist()
+		if !ok {
+			return false
+		}
+		switch {
+		case event.Key() == tcell.KeyDelete:
+			openConfirm("Are you sure you want to \ndelete "+pl.Name+"?", func() {
+				if !showPlaylistError(library.Current.DeletePlaylist(pl.ID)) {
+					showPlaylists()
+				}
+			})
+		case event.Key() == tcell.KeyRune && event.Rune() == 'e' && pl.IsSmart():
+			openInput(" Rules for "+tview.Escape(pl.Name)+" ", pl.Rules, func(rules string) {
+				if !showPlaylistError(library.Current.SetPlaylistRules(pl.ID, rules)) {
+					showPlaylists()
+				}
+			})
+		case event.Key() == tcell.KeyRune && event.Rune() == 'e':
+			editPlaylist(pl)
+		case event.Key() == tcell.KeyRune && event.Rune() == 'r':
+			openInput(" New name for playlist ", pl.Name, func(name string) {
+				if !showPlaylistError(library.Current.RenamePlaylist(pl.ID, name)) {
+					showPlaylists()
+				}
+			})
+		case event.Key() == tcell.KeyRune && event.Rune() == 'a':
+			if !showPlaylistError(library.Current.AppendToPlaylist(pl.ID, audioplayer.Playlist)) {
+				showPlaylists()
+			}
+		case event.Key() == tcell.KeyRune && event.Rune() == 'o':
+			openConfirm("Are you sure you want to \noverwrite "+pl.Name+"?", func() {
+				if !showPlaylistError(library.Current.OverwritePlaylist(pl.ID, audioplayer.Playlist)) {
+					showPlaylists()
+				}
+			})
+		default:
+			return false
+		}
+		return true
+
+	case "entries":
+		switch {
+		case event.Key() == tcell.KeyDelete:
+			if len(filelistFiles) > 0 && !showPlaylistError(library.Current.RemovePlaylistEntry(editingPlaylist.ID, myTui.filelist.GetCurrentItem())) {
+				editPlaylist(editingPlaylist)
+			}
+		case event.Key() == tcell.KeyRune && event.Rune() == '-':
+			moveEntry(-1)
+		case event.Key() == tcell.KeyRune && (event.Rune() == '+' || event.Rune() == '='):
+			moveEntry(1)
+		case event.Key() == tcell.KeyBackspace || event.Key() == tcell.KeyBackspace2:
+			showPlaylists()
+		default:
+			return false
+		}
+		return true
+
+	default:
+		// add the selected track to the playlist that was edited last
+		if event.Key() != tcell.KeyRune || event.Rune() != 'p' || editingPlaylist.ID == 0 {
+			return false
+		}
+		index := myTui.filelist.GetCurrentItem()
+		if index >= len(filelistFiles) {
+			return true
+		}
+		showPlaylistError(library.Current.AddPlaylistEntry(editingPlaylist.ID, filelistFiles[index].ID, -1))
+		if index < len(filelistFiles)-1 {
+			myTui.filelist.SetCurrentItem(index + 1)
+		}
+		return true
+	}
+}
@@ -0,0 +1,105 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"strings"
+
+	"github.com/MeesCode/mmjs/audioplayer"
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ratingToDisplayText shows the rating as stars, followed by a heart for favourites
+func ratingToDisplayText(track globals.Track) string {
+	var display = "unrated"
+	if track.Rating > 0 {
+		display = strings.Repeat("★", track.Rating) + strings.Repeat("☆", 5-track.Rating)
+	}
+	if track.Favourite {
+		display += " ♥"
+	}
+	return display
+}
+
+// selectedTrack returns the track under the cursor of the file list or the playlist
+func selectedTrack(list *tview.List) (globals.Track, bool) {
+	index := list.GetCurrentItem()
+	if list == myTui.playlist && index < len(audioplayer.Playlist) {
+		return audioplayer.Playlist[index], true
+	}
+	if list == myTui.filelist && index < len(filelistFiles) {
+		return filelistFiles[index], true
+	}
+	return globals.Track{}, false
+}
+
+// handleRatingKeys rates the selected track with 0 to 5 or toggles it
+// as favourite with *. Returns whether the key was handled.
+func handleRatingKeys(list *tview.List, event *tcell.EventKey) bool {
+	if event.Key() != tcell.KeyRune {
+		return false
+	}
+
+	r := event.Rune()
+	if r != '*' && (r < '0' || r > '5') {
+		return false
+	}
+
+	track, ok := selectedTrack(list)
+	if !ok {
+		return true
+	}
+
+	var err error
+	if r == '*' {
+		track.Favourite = !track.Favourite
+		err = library.Current.SetFavourite(track.ID, track.Favourite)
+	} else {
+		track.Rating = int(r - '0')
+		err = library.Current.SetRating(track.ID, track.Rating)
+	}
+
+	if err != nil {
+		notify("could not rate track", err)
+		return true
+	}
+
+	updateTrackCopies(track)
+	return true
+}
+
+// updateTrackCopies replaces the tags, rating and favourite of every copy of
+// the track in the queue and the file list, and redraws the info boxes.
+func updateTrackCopies(track globals.Track) {
+	for i := range audioplayer.Playlist {
+		if audioplayer.Playlist[i].ID == track.ID {
+			copyTags(&audioplayer.Playlist[i], track)
+		}
+	}
+	for i := range filelistFiles {
+		if filelistFiles[i].ID == track.ID {
+			copyTags(&filelistFiles[i], track)
+		}
+	}
+
+	updateInfoBox(audioplayer.GetPlaying(), myTui.infobox)
+	if selected, ok := selectedTrack(myTui.filelist); ok {
+		updateInfoBox(selected, myTui.browseinfobox)
+	}
+}
+
+// copyTags copies everything that can be edited from one copy of a track to
+// another, the state of the copy in the queue is kept.
+func copyTags(dst *globals.Track, src globals.Track) {
+	dst.Title = src.Title
+	dst.Artist = src.Artist
+	dst.Album = src.Album
+	dst.Genre = src.Genre
+	dst.Year = src.Year
+	dst.Inferred = src.Inferred
+	dst.Rating = src.Rating
+	dst.Favourite = src.Favourite
+}
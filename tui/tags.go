@@ -0,0 +1,144 @@
+// Package tui provides all means to draw and interact with the user interface.
+package tui
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/MeesCode/mmjs/globals"
+	"github.com/MeesCode/mmjs/library"
+	"github.com/MeesCode/mmjs/metadata"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// the tracks in the tag editor and the values that were shown when it was
+// opened. Only the fields whose value is changed are saved, so a batch edit
+// leaves the other tags of every track alone.
+var (
+	editingTracks []globals.Track
+	editingValues map[string]string
+)
+
+// commonTags returns the value of every field that all tracks have in common,
+// fields with different values are left out.
+func commonTags(tracks []globals.Track) map[string]string {
+	values := make(map[string]string)
+	for _, field := range metadata.Fields {
+		value := tracks[0].Tag(field)
+		for _, track := range tracks[1:] {
+			if track.Tag(field) != value {
+				value = ""
+				break
+			}
+		}
+		values[field] = value
+	}
+	return values
+}
+
+// openTagEditor opens a form to edit the tags of one or more tracks. With
+// several tracks the fields show the value they have in common.
+func openTagEditor(tracks []globals.Track) {
+	if len(tracks) == 0 || myTui.pages.HasPage("tags") {
+		return
+	}
+
+	editingTracks = tracks
+	editingValues = commonTags(tracks)
+
+	form := myTui.tagform
+	form.Clear(true)
+	for _, field := range metadata.Fields {
+		input := tview.NewInputField().
+			SetLabel(strings.Title(field)).
+			SetText(editingValues[field])
+		if editingValues[field] == "" && len(tracks) > 1 {
+			input.SetPlaceholder("(keep)")
+		}
+		if field == "year" {
+			input.SetAcceptanceFunc(tview.InputFieldInteger)
+		}
+		form.AddFormItem(input)
+	}
+	form.AddCheckbox("Write to files", false, nil)
+	form.AddButton("save", saveTags)
+	form.AddButton("cancel", closeModals)
+	form.SetFocus(0)
+
+	if len(tracks) == 1 {
+		form.SetTitle(" Edit " + tview.Escape(trackToDisplayText(tracks[0])) + " ")
+	} else {
+		form.SetTitle(" Edit " + strconv.Itoa(len(tracks)) + " tracks ")
+	}
+
+	myTui.pages.AddPage("tags", myTui.tagbox, true, true)
+	focusWithColor(form)
+}
+
+// saveTags saves the fields that were changed in the tag editor to all
+// tracks that were being edited.
+func saveTags() {
+	changes := make(map[string]string)
+	for i, field := range metadata.Fields {
+		value := strings.TrimSpace(myTui.tagform.GetFormItem(i).(*tview.InputField).GetText())
+		if value != editingValues[field] {
+			changes[field] = value
+		}
+	}
+	writeBack := myTui.tagform.GetFormItem(len(metadata.Fields)).(*tview.Checkbox).IsChecked()
+	tracks := editingTracks
+
+	closeModals()
+	if len(changes) == 0 {
+		return
+	}
+
+	ids := make([]int, 0, len(tracks))
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+
+	err := library.Current.EditTags(ids, changes, writeBack)
+	if err != nil {
+		notify("could not edit tags", err)
+		if !errors.Is(err, library.ErrWriteBack) {
+			return
+		}
+	}
+
+	// show the new tags everywhere the tracks are listed
+	for _, id := range ids {
+		track, err := library.Current.Track(id)
+		if err != nil {
+			notify("could not find edited track", err)
+			continue
+		}
+		updateTrackCopies(track)
+	}
+	redrawTracks()
+}
+
+// handleTagKeys opens the tag editor with t for the selected track or with T
+// for every track in the file list. Returns whether the key was handled.
+func handleTagKeys(list *tview.List, event *tcell.EventKey) bool {
+	if event.Key() != tcell.KeyRune {
+		return false
+	}
+
+	switch {
+	case event.Rune() == 't':
+		if track, ok := selectedTrack(list); ok {
+			openTagEditor([]globals.Track{track})
+		}
+	case event.Rune() == 'T' && list == myTui.filelist:
+		if loadAll() {
+			openTagEditor(append([]globals.Track(nil), filelistFiles...))
+		}
+	default:
+		return false
+	}
+	return true
+}